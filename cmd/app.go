@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/LeeZXin/zallet/internal/global"
 	"github.com/urfave/cli/v2"
 	"runtime"
 )
@@ -10,11 +11,24 @@ var (
 		Run,
 		Apply,
 		Service,
+		Exec,
 		Health,
 		Kill,
 		Delete,
 		Restart,
 		Ls,
+		Logs,
+		Reload,
+		Stats,
+		Events,
+		Runs,
+		History,
+		Rollback,
+		Scale,
+		Stack,
+		Render,
+		Migrate,
+		Instances,
 	}
 )
 
@@ -25,7 +39,7 @@ func NewCliApp() *cli.App {
 	app.Commands = cmdList
 	app.Name = "zallet"
 	app.Usage = "A zallet server used for deploy service"
-	app.Version = formatBuiltWith()
+	app.Version = global.Version + formatBuiltWith()
 	return app
 }
 
@@ -8,51 +8,149 @@ import (
 	"github.com/LeeZXin/zallet/internal/process"
 	"github.com/LeeZXin/zallet/internal/util"
 	"github.com/urfave/cli/v2"
-	"gopkg.in/yaml.v3"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 )
 
 var Apply = &cli.Command{
 	Name:   "apply",
-	Usage:  "This command starts process service",
+	Usage:  "This command creates or replaces process service declared by yaml",
 	Action: apply,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name: "sock",
 		},
 		&cli.StringFlag{
 			Name: "file",
 		},
-	},
+		&cli.StringFlag{
+			Name: "note",
+		},
+		&cli.BoolFlag{
+			Name: "dry-run",
+		},
+		&cli.StringFlag{
+			Name: "dir",
+		},
+		&cli.BoolFlag{
+			Name: "prune",
+		},
+		&cli.BoolFlag{
+			Name: "global",
+		},
+	}, renderFlags()...),
 }
 
-func apply(ctx *cli.Context) error {
+// renderFlags 渲染配置文件的参数
+func renderFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name: "values",
+		},
+		&cli.StringSliceFlag{
+			Name: "set",
+		},
+		&cli.StringFlag{
+			Name: "overlay",
+		},
+	}
+}
+
+func readAppYaml(ctx *cli.Context) (process.Yaml, error) {
 	filePath := ctx.String("file")
 	if filePath == "" {
-		return errors.New("invalid -file")
+		return process.Yaml{}, errors.New("invalid -file")
+	}
+	return process.RenderYamlFile(filePath, process.RenderOpts{
+		ValuesFiles: ctx.StringSlice("values"),
+		Sets:        ctx.StringSlice("set"),
+		Overlay:     ctx.String("overlay"),
+	})
+}
+
+func apply(ctx *cli.Context) error {
+	if ctx.String("dir") != "" {
+		return applyDir(ctx)
 	}
-	content, err := os.ReadFile(filePath)
+	if ctx.Bool("global") && ctx.Bool("dry-run") {
+		return errors.New("-dry-run can not be used with -global")
+	}
+	y, err := readAppYaml(ctx)
 	if err != nil {
 		return err
 	}
-	var y process.Yaml
-	err = yaml.Unmarshal(content, &y)
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	// startFirst需要等待新服务就绪 不能有超时时间
+	httpClient.Timeout = 0
+	req, _ := json.Marshal(y)
+	resp, err := httpClient.Post(
+		fmt.Sprintf("http://fake/api/v1/apply?note=%s&dryRun=%v&global=%v", url.QueryEscape(ctx.String("note")), ctx.Bool("dry-run"), ctx.Bool("global")),
+		"application/yaml;charset=utf-8",
+		bytes.NewReader(req),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+	return err
+}
+
+// applyDir 使服务与目录中的配置一致 -prune时删除目录中已不存在的服务
+func applyDir(ctx *cli.Context) error {
+	if ctx.Bool("dry-run") {
+		return errors.New("-dry-run can not be used with -dir")
+	}
+	if ctx.Bool("global") {
+		return errors.New("-global can not be used with -dir")
+	}
+	// 目录中的配置文件不渲染 与后台监听目录时的行为一致
+	for _, name := range []string{"values", "set", "overlay"} {
+		if ctx.IsSet(name) {
+			return fmt.Errorf("-%s can not be used with -dir", name)
+		}
+	}
+	dir, err := filepath.Abs(ctx.String("dir"))
 	if err != nil {
 		return err
 	}
-	err = y.IsValid()
+	manifests, err := process.ReadManifestDir(dir)
 	if err != nil {
 		return err
 	}
+	yamls := make([]process.Yaml, 0, len(manifests))
+	for _, m := range manifests {
+		if m.Err != nil {
+			return fmt.Errorf("invalid file %s: %v", m.File, m.Err)
+		}
+		yamls = append(yamls, m.Yaml)
+	}
 	sockFile := getSockFile(ctx)
 	httpClient := util.NewUnixHttpClient(sockFile)
 	defer httpClient.CloseIdleConnections()
-	req, _ := json.Marshal(y)
+	// 需要等待服务就绪或优雅停止 不能有超时时间
+	httpClient.Timeout = 0
+	query := url.Values{}
+	query.Set("source", dir)
+	query.Set("prune", strconv.FormatBool(ctx.Bool("prune")))
+	req, _ := json.Marshal(yamls)
 	resp, err := httpClient.Post(
-		"http://fake/api/v1/apply",
-		"application/yaml;charset=utf-8",
+		fmt.Sprintf("http://fake/api/v1/reconcile?%s", query.Encode()),
+		"application/json;charset=utf-8",
 		bytes.NewReader(req),
 	)
 	if err != nil {
@@ -66,5 +164,7 @@ func apply(ctx *cli.Context) error {
 		}
 		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
 	}
-	return nil
+	_, err = io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+	return err
 }
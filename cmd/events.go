@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var Events = &cli.Command{
+	Name:   "events",
+	Usage:  "This command prints service status events",
+	Action: events,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "service",
+		},
+		&cli.StringFlag{
+			Name: "app",
+		},
+		&cli.StringFlag{
+			Name: "since",
+		},
+		&cli.BoolFlag{
+			Name: "global",
+		},
+		&cli.BoolFlag{
+			Name:    "follow",
+			Aliases: []string{"f"},
+		},
+	},
+}
+
+func events(ctx *cli.Context) error {
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	// 持续输出事件 不能有超时时间
+	httpClient.Timeout = 0
+	query := url.Values{}
+	query.Set("serviceId", ctx.String("service"))
+	query.Set("app", ctx.String("app"))
+	query.Set("since", ctx.String("since"))
+	query.Set("global", strconv.FormatBool(ctx.Bool("global")))
+	query.Set("follow", strconv.FormatBool(ctx.Bool("follow")))
+	resp, err := httpClient.Get(fmt.Sprintf("http://fake/api/v1/events?%s", query.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event servicemd.ServiceEvent
+		err = decoder.Decode(&event)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(formatEvent(event))
+	}
+}
+
+func formatEvent(event servicemd.ServiceEvent) string {
+	fields := []string{
+		time.UnixMilli(event.EventTime).Format("2006-01-02T15:04:05.000Z07:00"),
+		event.ServiceId,
+		event.App,
+		event.Env,
+		event.Status,
+		fmt.Sprintf("pid=%d", event.Pid),
+		fmt.Sprintf("processPid=%d", event.ProcessPid),
+		fmt.Sprintf("cpu=%d%%", event.CpuPercent),
+		fmt.Sprintf("mem=%d%%", event.MemPercent),
+	}
+	if event.StopReason != "" {
+		fields = append(fields, "stopReason="+event.StopReason, fmt.Sprintf("exitCode=%d", event.ExitCode))
+		if event.ExitSignal != "" {
+			fields = append(fields, "signal="+strconv.Quote(event.ExitSignal))
+		}
+	}
+	if event.ErrLog != "" {
+		fields = append(fields, "errLog="+strconv.Quote(event.ErrLog))
+	}
+	return strings.Join(fields, " ")
+}
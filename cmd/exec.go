@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/urfave/cli/v2"
+)
+
+var Exec = &cli.Command{
+	Name:            process.ExecCmdName,
+	Usage:           "This command sets process attributes and execs target command, should only called by zallet supervisor",
+	Action:          execWithAttr,
+	HideHelp:        true,
+	SkipFlagParsing: true,
+}
+
+func execWithAttr(ctx *cli.Context) error {
+	return process.ExecWithAttr(ctx.Args().Slice())
+}
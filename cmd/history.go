@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var History = &cli.Command{
+	Name:   "history",
+	Usage:  "This command lists applied revisions of app",
+	Action: history,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "app",
+		},
+		&cli.StringFlag{
+			Name: "env",
+		},
+		&cli.StringFlag{
+			Name: "name",
+		},
+	},
+}
+
+var Rollback = &cli.Command{
+	Name:   "rollback",
+	Usage:  "This command re-applies an older revision of app",
+	Action: rollback,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "app",
+		},
+		&cli.StringFlag{
+			Name: "env",
+		},
+		&cli.StringFlag{
+			Name: "name",
+		},
+		&cli.IntFlag{
+			Name: "revision",
+		},
+	},
+}
+
+func history(ctx *cli.Context) error {
+	app := ctx.String("app")
+	name := ctx.String("name")
+	if app == "" && name == "" {
+		return errors.New("invalid -app or -name")
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	query := url.Values{}
+	query.Set("app", app)
+	query.Set("env", ctx.String("env"))
+	query.Set("name", name)
+	resp, err := httpClient.Get(fmt.Sprintf("http://fake/api/v1/history?%s", query.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	ret := make([]servicemd.ServiceRevision, 0)
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return err
+	}
+	table := make([][]string, 0, len(ret))
+	for _, r := range ret {
+		table = append(table, []string{
+			strconv.Itoa(r.Revision),
+			r.Name,
+			r.Env,
+			r.Created.Format("2006-01-02 15:04:05"),
+			r.InstanceId,
+			r.Note,
+		})
+	}
+	printTable([]string{"revision", "name", "env", "created", "instanceId", "note"}, table)
+	return nil
+}
+
+func rollback(ctx *cli.Context) error {
+	app := ctx.String("app")
+	name := ctx.String("name")
+	if app == "" && name == "" {
+		return errors.New("invalid -app or -name")
+	}
+	revision := ctx.Int("revision")
+	if revision <= 0 {
+		return errors.New("invalid -revision")
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	query := url.Values{}
+	query.Set("app", app)
+	query.Set("env", ctx.String("env"))
+	query.Set("name", name)
+	query.Set("revision", strconv.Itoa(revision))
+	request, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://fake/api/v1/rollback?%s", query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	fmt.Println(fmt.Sprintf("%s rollback to revision %d ok", process.ServiceKey(app, ctx.String("env"), name), revision))
+	return nil
+}
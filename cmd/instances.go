@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var Instances = &cli.Command{
+	Name:   "instances",
+	Usage:  "This command lists zallet instances",
+	Action: instances,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+	},
+}
+
+func instances(ctx *cli.Context) error {
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	resp, err := httpClient.Get("http://fake/api/v1/instances")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	ret := make([]global.InstanceVO, 0)
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return err
+	}
+	table := make([][]string, 0, len(ret))
+	for _, vo := range ret {
+		status := "alive"
+		if !vo.Alive {
+			status = "dead"
+		}
+		if vo.Leader {
+			status += "(leader)"
+		}
+		table = append(table, []string{
+			vo.InstanceId,
+			vo.LocalIp,
+			vo.AgentHost,
+			vo.Version,
+			status,
+			strconv.Itoa(vo.CpuPercent) + "%",
+			strconv.Itoa(vo.MemPercent) + "%",
+			strconv.Itoa(vo.DiskPercent) + "%",
+			time.UnixMilli(vo.StartTime).Format("2006-01-02 15:04:05"),
+			time.UnixMilli(vo.Heartbeat).Format("2006-01-02 15:04:05"),
+			formatLabels(vo.Labels),
+		})
+	}
+	printTable([]string{"instanceId", "localIp", "agentHost", "version", "status", "cpu", "mem", "disk", "startTime", "heartbeat", "labels"}, table)
+	return nil
+}
+
+func formatLabels(labels map[string]string) string {
+	ret := make([]string, 0, len(labels))
+	for k, v := range labels {
+		ret = append(ret, k+"="+v)
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ",")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+var Logs = &cli.Command{
+	Name:   "logs",
+	Usage:  "This command prints service logs",
+	Action: logs,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "service",
+		},
+		&cli.BoolFlag{
+			Name:    "follow",
+			Aliases: []string{"f"},
+		},
+		&cli.IntFlag{
+			Name: "tail",
+		},
+		&cli.StringFlag{
+			Name: "since",
+		},
+	},
+}
+
+func logs(ctx *cli.Context) error {
+	serviceId := ctx.String("service")
+	if serviceId == "" {
+		return errors.New("invalid -service")
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	// 持续输出日志 不能有超时时间
+	httpClient.Timeout = 0
+	query := url.Values{}
+	query.Set("tail", strconv.Itoa(ctx.Int("tail")))
+	query.Set("since", ctx.String("since"))
+	query.Set("follow", strconv.FormatBool(ctx.Bool("follow")))
+	resp, err := httpClient.Get(fmt.Sprintf("http://fake/api/v1/logs/%s?%s", serviceId, query.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var Ls = &cli.Command{
@@ -32,9 +33,17 @@ var Ls = &cli.Command{
 		&cli.StringFlag{
 			Name: "status",
 		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+		},
 	},
 }
 
+const (
+	maxOutputTailWidth = 60
+)
+
 func ls(ctx *cli.Context) error {
 	sockFile := getSockFile(ctx)
 	httpClient := util.NewUnixHttpClient(sockFile)
@@ -67,57 +76,73 @@ func ls(ctx *cli.Context) error {
 		}
 		return nil
 	}
+	wide := ctx.String("output") == "wide"
 	rows := []string{"serviceId", "app", "env", "serviceStatus", "pid", "agentHost"}
-	maxVarLength := make([]int, 6)
-	for i := 0; i < 6; i++ {
-		maxVarLength[i] = len(rows[i])
+	if wide {
+		rows = append(rows, "replica", "restartCount", "stopReason", "exitCode", "signal", "coreDumped", "runtime", "outputTail")
 	}
+	table := make([][]string, 0, len(ret))
 	for _, vo := range ret {
-		p := len(vo.ServiceId)
-		if maxVarLength[0] < p {
-			maxVarLength[0] = p
-		}
-		p = len(vo.App)
-		if maxVarLength[1] < p {
-			maxVarLength[1] = p
+		status := vo.ServiceStatus
+		if vo.Orphaned {
+			status += "(orphaned)"
 		}
-		p = len(vo.Env)
-		if maxVarLength[2] < p {
-			maxVarLength[2] = p
+		line := []string{vo.ServiceId, vo.App, vo.Env, status, strconv.Itoa(vo.Pid), vo.AgentHost}
+		if wide {
+			exitCode := ""
+			if vo.StopReason != "" {
+				exitCode = strconv.Itoa(vo.ExitCode)
+			}
+			line = append(line,
+				strconv.Itoa(vo.ReplicaIndex),
+				strconv.Itoa(vo.RestartCount),
+				vo.StopReason,
+				exitCode,
+				vo.Signal,
+				strconv.FormatBool(vo.CoreDumped),
+				(time.Duration(vo.Runtime) * time.Millisecond).String(),
+				lastOutputLine(vo.OutputTail),
+			)
 		}
-		p = len(vo.ServiceStatus)
-		if maxVarLength[3] < p {
-			maxVarLength[3] = p
-		}
-		p = len(strconv.Itoa(vo.Pid))
-		if maxVarLength[4] < p {
-			maxVarLength[4] = p
-		}
-		p = len(vo.AgentHost)
-		if maxVarLength[5] < p {
-			maxVarLength[5] = p
+		table = append(table, line)
+	}
+	printTable(rows, table)
+	return nil
+}
+
+// lastOutputLine 只展示最后一行输出 过长时截断
+func lastOutputLine(output string) string {
+	output = strings.TrimRight(output, "\n")
+	if i := strings.LastIndexByte(output, '\n'); i >= 0 {
+		output = output[i+1:]
+	}
+	if len(output) > maxOutputTailWidth {
+		output = "..." + output[len(output)-maxOutputTailWidth:]
+	}
+	return output
+}
+
+func printTable(rows []string, table [][]string) {
+	maxVarLength := make([]int, len(rows))
+	for i, row := range rows {
+		maxVarLength[i] = len(row)
+	}
+	for _, line := range table {
+		for i, v := range line {
+			if maxVarLength[i] < len(v) {
+				maxVarLength[i] = len(v)
+			}
 		}
 	}
-	padding := func(str string, l int) string {
-		return str + strings.Repeat(" ", l-len(str))
+	padding := func(line []string) string {
+		ret := make([]string, 0, len(line))
+		for i, str := range line {
+			ret = append(ret, str+strings.Repeat(" ", maxVarLength[i]-len(str)))
+		}
+		return strings.TrimRight(strings.Join(ret, "  "), " ")
 	}
-	fmt.Println(fmt.Sprintf("%s  %s  %s  %s  %s  %s",
-		padding(rows[0], maxVarLength[0]),
-		padding(rows[1], maxVarLength[1]),
-		padding(rows[2], maxVarLength[2]),
-		padding(rows[3], maxVarLength[3]),
-		padding(rows[4], maxVarLength[4]),
-		padding(rows[5], maxVarLength[5]),
-	))
-	for _, vo := range ret {
-		fmt.Println(fmt.Sprintf("%s  %s  %s  %s  %s  %s",
-			padding(vo.ServiceId, maxVarLength[0]),
-			padding(vo.App, maxVarLength[1]),
-			padding(vo.Env, maxVarLength[2]),
-			padding(vo.ServiceStatus, maxVarLength[3]),
-			padding(strconv.Itoa(vo.Pid), maxVarLength[4]),
-			padding(vo.AgentHost, maxVarLength[5]),
-		))
+	fmt.Println(padding(rows))
+	for _, line := range table {
+		fmt.Println(padding(line))
 	}
-	return nil
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/migrate"
+	"github.com/urfave/cli/v2"
+	"strings"
+)
+
+var Migrate = &cli.Command{
+	Name:   "migrate",
+	Usage:  "This command migrates zallet tables",
+	Action: migrateTables,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print pending ddl without executing",
+		},
+	},
+}
+
+func migrateTables(ctx *cli.Context) error {
+	global.Init()
+	if !ctx.Bool("dry-run") {
+		if err := migrate.Run(global.Xengine); err != nil {
+			return err
+		}
+		fmt.Println("migrate ok")
+		return nil
+	}
+	pending, err := migrate.Pending(global.Xengine)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("no pending migrations")
+		return nil
+	}
+	for _, m := range pending {
+		fmt.Printf("-- version: %d %s\n", m.Version, m.Description)
+		for _, sql := range m.Sqls {
+			fmt.Println(strings.TrimSuffix(sql, ";") + ";")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var Reload = &cli.Command{
+	Name:   "reload",
+	Usage:  "This command reloads process service with new yaml and keeps the serviceId",
+	Action: reload,
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "service",
+		},
+		&cli.StringFlag{
+			Name: "file",
+		},
+		&cli.StringFlag{
+			Name: "note",
+		},
+	}, renderFlags()...),
+}
+
+func reload(ctx *cli.Context) error {
+	serviceId := ctx.String("service")
+	if serviceId == "" {
+		return errors.New("invalid -service")
+	}
+	y, err := readAppYaml(ctx)
+	if err != nil {
+		return err
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	req, _ := json.Marshal(y)
+	request, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://fake/api/v1/reload/%s?note=%s", serviceId, url.QueryEscape(ctx.String("note"))), bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/yaml;charset=utf-8")
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	fmt.Println(fmt.Sprintf("%s ok", serviceId))
+	return nil
+}
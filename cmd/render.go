@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+var Render = &cli.Command{
+	Name:   "render",
+	Usage:  "This command prints the rendered yaml without applying it",
+	Action: render,
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name: "file",
+		},
+	}, renderFlags()...),
+}
+
+func render(ctx *cli.Context) error {
+	y, err := readAppYaml(ctx)
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(y)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var Runs = &cli.Command{
+	Name:   "runs",
+	Usage:  "This command lists runs of job or cron service",
+	Action: runs,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "service",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Value: 20,
+		},
+	},
+}
+
+func runs(ctx *cli.Context) error {
+	serviceId := ctx.String("service")
+	if serviceId == "" {
+		return errors.New("invalid -service")
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	query := url.Values{}
+	query.Set("serviceId", serviceId)
+	query.Set("limit", strconv.Itoa(ctx.Int("limit")))
+	resp, err := httpClient.Get(fmt.Sprintf("http://fake/api/v1/runs?%s", query.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	ret := make([]servicemd.ServiceRun, 0)
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return err
+	}
+	table := make([][]string, 0, len(ret))
+	for _, r := range ret {
+		table = append(table, []string{
+			time.UnixMilli(r.StartTime).Format("2006-01-02 15:04:05"),
+			(time.Duration(r.Duration) * time.Millisecond).String(),
+			r.Status,
+			r.StopReason,
+			strconv.Itoa(r.ExitCode),
+			r.ExitSignal,
+		})
+	}
+	printTable([]string{"startTime", "duration", "status", "stopReason", "exitCode", "signal"}, table)
+	return nil
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+var Scale = &cli.Command{
+	Name:   "scale",
+	Usage:  "This command adds or removes replicas of app",
+	Action: scale,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "app",
+		},
+		&cli.StringFlag{
+			Name: "env",
+		},
+		&cli.StringFlag{
+			Name: "name",
+		},
+		&cli.IntFlag{
+			Name:  "replicas",
+			Value: -1,
+		},
+	},
+}
+
+func scale(ctx *cli.Context) error {
+	name := ctx.String("name")
+	if name == "" && (ctx.String("app") == "" || ctx.String("env") == "") {
+		return errors.New("invalid -app or -env")
+	}
+	replicas := ctx.Int("replicas")
+	if replicas < 0 {
+		return errors.New("invalid -replicas")
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	// 删除副本需要等待优雅停止 不能有超时时间
+	httpClient.Timeout = 0
+	query := url.Values{}
+	query.Set("app", ctx.String("app"))
+	query.Set("env", ctx.String("env"))
+	query.Set("name", name)
+	query.Set("replicas", strconv.Itoa(replicas))
+	request, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://fake/api/v1/scale?%s", query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(message))
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+	return err
+}
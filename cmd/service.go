@@ -31,12 +31,14 @@ func service(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	// zallet退出后stderr管道会断开 忽略SIGPIPE防止supervisor退出
+	signal.Ignore(syscall.SIGPIPE)
 	supv := process.NewSupervisor(opts)
 	err = supv.Run()
 	if err != nil {
 		return err
 	}
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	select {
 	case <-quit:
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/stack"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var Stack = &cli.Command{
+	Name:  "stack",
+	Usage: "This command manages services declared in stack file",
+	Subcommands: []*cli.Command{
+		newStackCommand("up", "This command starts stack services in dependency order", stackUp),
+		newStackCommand("down", "This command stops stack services in reverse dependency order", stackDown),
+		newStackCommand("ls", "This command lists stack services", stackLs),
+	},
+}
+
+func newStackCommand(name, usage string, action cli.ActionFunc) *cli.Command {
+	return &cli.Command{
+		Name:   name,
+		Usage:  usage,
+		Action: action,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name: "sock",
+			},
+			&cli.StringFlag{
+				Name: "file",
+			},
+		},
+	}
+}
+
+func readStackYaml(filePath string) (stack.Cfg, error) {
+	var cfg stack.Cfg
+	if filePath == "" {
+		return cfg, errors.New("invalid -file")
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return cfg, err
+	}
+	err = yaml.Unmarshal(content, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.IsValid()
+}
+
+// postStack 发送stack文件 返回响应内容
+func postStack(ctx *cli.Context, op string) ([]byte, error) {
+	cfg, err := readStackYaml(ctx.String("file"))
+	if err != nil {
+		return nil, err
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	// 需要等待服务就绪或优雅停止 不能有超时时间
+	httpClient.Timeout = 0
+	req, _ := json.Marshal(cfg)
+	resp, err := httpClient.Post(
+		"http://fake/api/v1/stack/"+op,
+		"application/json;charset=utf-8",
+		bytes.NewReader(req),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+func stackUp(ctx *cli.Context) error {
+	body, err := postStack(ctx, "up")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+func stackDown(ctx *cli.Context) error {
+	body, err := postStack(ctx, "down")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+func stackLs(ctx *cli.Context) error {
+	body, err := postStack(ctx, "ls")
+	if err != nil {
+		return err
+	}
+	ret := make([]global.StackServiceVO, 0)
+	err = json.Unmarshal(body, &ret)
+	if err != nil {
+		return err
+	}
+	table := make([][]string, 0)
+	for _, vo := range ret {
+		dependsOn := strings.Join(vo.DependsOn, ",")
+		if len(vo.Services) == 0 {
+			table = append(table, []string{vo.Service, dependsOn, "", "", "notCreated", ""})
+			continue
+		}
+		for _, srv := range vo.Services {
+			table = append(table, []string{
+				vo.Service,
+				dependsOn,
+				srv.ServiceId,
+				strconv.Itoa(srv.ReplicaIndex),
+				srv.ServiceStatus,
+				strconv.Itoa(srv.Pid),
+			})
+		}
+	}
+	printTable([]string{"service", "dependsOn", "serviceId", "replica", "serviceStatus", "pid"}, table)
+	return nil
+}
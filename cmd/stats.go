@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/urfave/cli/v2"
+	"io"
+	"net/http"
+)
+
+var Stats = &cli.Command{
+	Name:   "stats",
+	Usage:  "This command prints process service stats and probe state",
+	Action: stats,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name: "sock",
+		},
+		&cli.StringFlag{
+			Name: "service",
+		},
+	},
+}
+
+func stats(ctx *cli.Context) error {
+	serviceId := ctx.String("service")
+	if serviceId == "" {
+		return errors.New("invalid -service")
+	}
+	sockFile := getSockFile(ctx)
+	httpClient := util.NewUnixHttpClient(sockFile)
+	defer httpClient.CloseIdleConnections()
+	resp, err := httpClient.Get(fmt.Sprintf("http://fake/api/v1/stats/%s", serviceId))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("zallet return http request statusCode: %v resp: %v", resp.StatusCode, string(body))
+	}
+	var out bytes.Buffer
+	err = json.Indent(&out, body, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(out.String())
+	return nil
+}
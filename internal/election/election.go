@@ -0,0 +1,286 @@
+package election
+
+import (
+	"context"
+	"github.com/LeeZXin/zallet/internal/util"
+	"log"
+	"sync"
+	"time"
+	"xorm.io/xorm"
+)
+
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRetryPeriod   = 5 * time.Second
+)
+
+// Lease 租约 holder在expireTime前持续续约即为leader
+type Lease struct {
+	Id     int64  `json:"id" xorm:"pk autoincr"`
+	Name   string `json:"name" xorm:"unique"`
+	Holder string `json:"holder"`
+	// AcquireTime 成为leader的时间 毫秒时间戳
+	AcquireTime int64 `json:"acquireTime"`
+	// ExpireTime 租约到期时间 毫秒时间戳
+	ExpireTime int64     `json:"expireTime"`
+	Created    time.Time `json:"created" xorm:"created"`
+}
+
+func (*Lease) TableName() string {
+	return "zallet_lease"
+}
+
+// IsValid 租约未过期 now为数据库时间
+func (l *Lease) IsValid(now int64) bool {
+	return l.Holder != "" && now < l.ExpireTime
+}
+
+// GetLease 查询租约 不存在时found为false
+func GetLease(session *xorm.Session, name string) (Lease, bool, error) {
+	var ret Lease
+	b, err := session.Where("name = ?", name).Get(&ret)
+	return ret, b, err
+}
+
+// tryAcquire 租约由自己持有或已过期时更新成功 不存在时新增
+// 多个实例同时竞争时 条件更新和name唯一索引保证只有一个成功
+func tryAcquire(session *xorm.Session, name, identity string, duration time.Duration) (bool, error) {
+	now, err := util.DBNowMilli(session)
+	if err != nil {
+		return false, err
+	}
+	lease, found, err := GetLease(session, name)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		_, err = session.Insert(&Lease{
+			Name:        name,
+			Holder:      identity,
+			AcquireTime: now,
+			ExpireTime:  now + duration.Milliseconds(),
+		})
+		if err != nil {
+			// 其他实例已新增
+			return false, nil
+		}
+		return true, nil
+	}
+	acquireTime := lease.AcquireTime
+	if lease.Holder != identity {
+		acquireTime = now
+	}
+	rows, err := session.
+		Where("name = ?", name).
+		And("(holder = ? or expire_time < ?)", identity, now).
+		Cols("holder", "acquire_time", "expire_time").
+		Update(&Lease{
+			Holder:      identity,
+			AcquireTime: acquireTime,
+			ExpireTime:  now + duration.Milliseconds(),
+		})
+	return rows == 1, err
+}
+
+// release 主动释放租约 其他实例无需等待过期
+func release(session *xorm.Session, name, identity string) error {
+	_, err := session.
+		Where("name = ?", name).
+		And("holder = ?", identity).
+		Cols("expire_time").
+		Update(&Lease{
+			ExpireTime: 0,
+		})
+	return err
+}
+
+type Callbacks struct {
+	// OnStartedLeading 成为leader时调用 失去leader时ctx被取消
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading 失去leader时调用 等待OnStartedLeading返回后才调用
+	OnStoppedLeading func()
+	// OnNewLeader 观察到leader变化时调用 包括自己
+	OnNewLeader func(identity string)
+}
+
+type Config struct {
+	// Name 租约名称 同名租约只有一个leader
+	Name string
+	// Identity 竞选者标识
+	Identity string
+	// LeaseDuration 租约时长 leader停止续约后其他实例需等待的时间
+	LeaseDuration time.Duration
+	// RetryPeriod 续约和竞选的间隔 需小于LeaseDuration
+	RetryPeriod time.Duration
+	Callbacks   Callbacks
+}
+
+func (c *Config) fillDefaults() {
+	if c.LeaseDuration <= 0 {
+		c.LeaseDuration = defaultLeaseDuration
+	}
+	if c.RetryPeriod <= 0 {
+		c.RetryPeriod = defaultRetryPeriod
+	}
+	if c.RetryPeriod >= c.LeaseDuration {
+		c.RetryPeriod = c.LeaseDuration / 3
+	}
+}
+
+// Elector 基于数据库租约的leader选举 租约时间以数据库时钟为准
+type Elector struct {
+	cfg        Config
+	engine     *xorm.Engine
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+
+	locker   sync.Mutex
+	isLeader bool
+	leader   string
+	// leadingCancel 取消OnStartedLeading的ctx
+	leadingCancel context.CancelFunc
+	leadingDone   chan struct{}
+}
+
+// Start 开始竞选 直到Shutdown
+func Start(engine *xorm.Engine, cfg Config) *Elector {
+	cfg.fillDefaults()
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ret := &Elector{
+		cfg:        cfg,
+		engine:     engine,
+		cancelFunc: cancelFunc,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(ret.done)
+		// 最近一次续约成功的时间
+		var renewTime time.Time
+		for {
+			acquired, err := ret.tryAcquireOrRenew()
+			now := time.Now()
+			if err != nil {
+				log.Printf("election: %s acquire lease failed with err: %v", cfg.Name, err)
+				// 无法确认租约时 在租约到期前主动放弃 避免同时存在两个leader
+				if ret.IsLeader() && now.Sub(renewTime) >= cfg.LeaseDuration-cfg.RetryPeriod {
+					ret.stopLeading()
+				}
+			} else if acquired {
+				renewTime = now
+				ret.startLeading()
+			} else {
+				ret.stopLeading()
+			}
+			select {
+			case <-ctx.Done():
+				ret.stopLeading()
+				if acquired {
+					ret.release()
+				}
+				return
+			case <-time.After(cfg.RetryPeriod):
+			}
+		}
+	}()
+	return ret
+}
+
+func (e *Elector) tryAcquireOrRenew() (bool, error) {
+	session := e.engine.NewSession()
+	defer session.Close()
+	acquired, err := tryAcquire(session, e.cfg.Name, e.cfg.Identity, e.cfg.LeaseDuration)
+	if err != nil {
+		return false, err
+	}
+	holder := e.cfg.Identity
+	if !acquired {
+		lease, found, err := GetLease(session, e.cfg.Name)
+		if err != nil {
+			return false, err
+		}
+		now, err := util.DBNowMilli(session)
+		if err != nil {
+			return false, err
+		}
+		holder = ""
+		if found && lease.IsValid(now) {
+			holder = lease.Holder
+		}
+	}
+	e.observeLeader(holder)
+	return acquired, nil
+}
+
+func (e *Elector) release() {
+	session := e.engine.NewSession()
+	defer session.Close()
+	if err := release(session, e.cfg.Name, e.cfg.Identity); err != nil {
+		log.Printf("election: %s release lease failed with err: %v", e.cfg.Name, err)
+	}
+}
+
+func (e *Elector) observeLeader(holder string) {
+	e.locker.Lock()
+	changed := e.leader != holder
+	e.leader = holder
+	e.locker.Unlock()
+	if changed && holder != "" && e.cfg.Callbacks.OnNewLeader != nil {
+		e.cfg.Callbacks.OnNewLeader(holder)
+	}
+}
+
+func (e *Elector) startLeading() {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	if e.isLeader {
+		return
+	}
+	e.isLeader = true
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	e.leadingCancel = cancelFunc
+	e.leadingDone = done
+	go func() {
+		defer close(done)
+		if e.cfg.Callbacks.OnStartedLeading != nil {
+			e.cfg.Callbacks.OnStartedLeading(ctx)
+		}
+	}()
+}
+
+func (e *Elector) stopLeading() {
+	e.locker.Lock()
+	if !e.isLeader {
+		e.locker.Unlock()
+		return
+	}
+	e.isLeader = false
+	cancelFunc, done := e.leadingCancel, e.leadingDone
+	e.leadingCancel, e.leadingDone = nil, nil
+	e.locker.Unlock()
+	cancelFunc()
+	<-done
+	if e.cfg.Callbacks.OnStoppedLeading != nil {
+		e.cfg.Callbacks.OnStoppedLeading()
+	}
+}
+
+// IsLeader 当前是否为leader
+func (e *Elector) IsLeader() bool {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	return e.isLeader
+}
+
+// GetLeader 最近一次观察到的leader 没有leader时为空
+func (e *Elector) GetLeader() string {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	return e.leader
+}
+
+// Shutdown 停止竞选 是leader时释放租约
+func (e *Elector) Shutdown() {
+	e.cancelFunc()
+	<-e.done
+}
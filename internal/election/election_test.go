@@ -0,0 +1,163 @@
+package election
+
+import (
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"testing"
+	"time"
+	"xorm.io/xorm"
+)
+
+func newTestEngine(t *testing.T) *xorm.Engine {
+	engine, err := xorm.NewEngine("sqlite", "file:"+filepath.Join(t.TempDir(), "zallet.db"))
+	if err != nil {
+		t.Fatalf("new engine failed with err: %v", err)
+	}
+	engine.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		engine.Close()
+	})
+	if err = engine.Sync(new(Lease)); err != nil {
+		t.Fatalf("sync table failed with err: %v", err)
+	}
+	return engine
+}
+
+func TestFillDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		duration time.Duration
+		retry    time.Duration
+	}{
+		{"empty", Config{}, defaultLeaseDuration, defaultRetryPeriod},
+		{"retry only", Config{RetryPeriod: time.Second}, defaultLeaseDuration, time.Second},
+		{"lease shorter than default retry", Config{LeaseDuration: 3 * time.Second}, 3 * time.Second, time.Second},
+		{"retry not less than lease", Config{LeaseDuration: 6 * time.Second, RetryPeriod: 6 * time.Second}, 6 * time.Second, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		tt.cfg.fillDefaults()
+		if tt.cfg.LeaseDuration != tt.duration || tt.cfg.RetryPeriod != tt.retry {
+			t.Errorf("%s: fillDefaults() = %v/%v, want %v/%v", tt.name, tt.cfg.LeaseDuration, tt.cfg.RetryPeriod, tt.duration, tt.retry)
+		}
+	}
+}
+
+func TestTryAcquire(t *testing.T) {
+	engine := newTestEngine(t)
+	session := engine.NewSession()
+	defer session.Close()
+	steps := []struct {
+		name     string
+		identity string
+		duration time.Duration
+		release  bool
+		expected bool
+	}{
+		{"first acquire", "a", time.Minute, false, true},
+		{"held by other", "b", time.Minute, false, false},
+		{"renew by holder", "a", time.Minute, false, true},
+		{"released", "a", 0, true, false},
+		{"acquire after release", "b", time.Minute, false, true},
+		{"old holder rejected", "a", time.Minute, false, false},
+	}
+	for _, step := range steps {
+		if step.release {
+			if err := release(session, "test", step.identity); err != nil {
+				t.Fatalf("%s: release failed with err: %v", step.name, err)
+			}
+			continue
+		}
+		acquired, err := tryAcquire(session, "test", step.identity, step.duration)
+		if err != nil {
+			t.Fatalf("%s: tryAcquire failed with err: %v", step.name, err)
+		}
+		if acquired != step.expected {
+			t.Errorf("%s: tryAcquire(%s) = %v, want %v", step.name, step.identity, acquired, step.expected)
+		}
+	}
+	lease, found, err := GetLease(session, "test")
+	if err != nil || !found {
+		t.Fatalf("GetLease found = %v err = %v", found, err)
+	}
+	if lease.Holder != "b" {
+		t.Errorf("lease holder = %s, want b", lease.Holder)
+	}
+}
+
+func TestTryAcquireExpired(t *testing.T) {
+	engine := newTestEngine(t)
+	session := engine.NewSession()
+	defer session.Close()
+	if acquired, err := tryAcquire(session, "test", "a", time.Millisecond); err != nil || !acquired {
+		t.Fatalf("tryAcquire(a) = %v, %v", acquired, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	acquired, err := tryAcquire(session, "test", "b", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("tryAcquire(b) after expiration = %v, %v", acquired, err)
+	}
+	lease, _, err := GetLease(session, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 换人时重新记录成为leader的时间
+	if lease.Holder != "b" || lease.AcquireTime <= 0 {
+		t.Errorf("lease = %+v, want held by b", lease)
+	}
+}
+
+// waitFor 轮询直到cond成立或超时
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("wait for %s timeout", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestElectorHandover(t *testing.T) {
+	engine := newTestEngine(t)
+	electors := make(map[string]*Elector)
+	for _, identity := range []string{"a", "b"} {
+		electors[identity] = Start(engine, Config{
+			Name:          "test",
+			Identity:      identity,
+			LeaseDuration: time.Minute,
+			RetryPeriod:   20 * time.Millisecond,
+		})
+	}
+	defer func() {
+		for _, e := range electors {
+			e.Shutdown()
+		}
+	}()
+	leader := ""
+	waitFor(t, "leader", func() bool {
+		for identity, e := range electors {
+			if e.IsLeader() {
+				leader = identity
+				return true
+			}
+		}
+		return false
+	})
+	follower := "a"
+	if leader == "a" {
+		follower = "b"
+	}
+	waitFor(t, "follower observes leader", func() bool {
+		return electors[follower].GetLeader() == leader
+	})
+	if electors[follower].IsLeader() {
+		t.Fatalf("both %s and %s are leaders", leader, follower)
+	}
+	// leader退出时释放租约 无需等待租约过期
+	electors[leader].Shutdown()
+	delete(electors, leader)
+	waitFor(t, "handover", func() bool {
+		return electors[follower].IsLeader()
+	})
+}
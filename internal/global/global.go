@@ -22,6 +22,8 @@ var (
 	SshHost    string
 	SshToken   string
 	LocalIp    string
+	// Version 编译时通过-ldflags "-X"设置
+	Version = "dev"
 )
 
 func Init() {
@@ -82,6 +84,9 @@ func newViper() *viper.Viper {
 }
 
 func newXormEngine() *xorm.Engine {
+	if IsEmbeddedStorage() {
+		return newSqliteEngine()
+	}
 	x, err := xorm.NewEngine("mysql", Viper.GetString("xorm.dataSourceName"))
 	if err != nil {
 		log.Fatalf("init xorm failed with err:%v", err)
@@ -98,3 +103,63 @@ func GetSshAgentPort() int {
 	}
 	return port
 }
+
+func GetCgroupSlice() string {
+	slice := Viper.GetString("cgroup.slice")
+	if slice == "" {
+		slice = "zallet.slice"
+	}
+	return slice
+}
+
+// GetManifestsDir 监听的服务配置目录
+func GetManifestsDir() string {
+	dir := Viper.GetString("manifests.dir")
+	if dir == "" {
+		dir = filepath.Join(BaseDir, "manifests")
+	}
+	return dir
+}
+
+// IsManifestsWatchEnabled 默认关闭 manifests.watch为true时开启
+func IsManifestsWatchEnabled() bool {
+	return Viper.GetBool("manifests.watch")
+}
+
+// GetInstanceLabels 实例标签 用于区分不同的agent
+func GetInstanceLabels() map[string]string {
+	return Viper.GetStringMapString("instance.labels")
+}
+
+// GetPlacementMaxServices 全局调度时实例最多运行的服务数 0为不限制
+func GetPlacementMaxServices() int {
+	return Viper.GetInt("placement.maxServices")
+}
+
+// GetPlacementMaxPercent 全局调度时实例cpu和内存使用率上限 默认90
+func GetPlacementMaxPercent() int {
+	percent := Viper.GetInt("placement.maxPercent")
+	if percent <= 0 {
+		percent = 90
+	}
+	return percent
+}
+
+// GetOrphanGcTimeout gc.orphanTimeout 实例停止心跳超过该时间后 由leader删除实例记录
+// 并把其本地服务标记为停止 原因为instanceLost 服务记录保留 实例恢复后重新接管 默认24h
+func GetOrphanGcTimeout() time.Duration {
+	timeout := Viper.GetDuration("gc.orphanTimeout")
+	if timeout <= 0 {
+		timeout = 24 * time.Hour
+	}
+	return timeout
+}
+
+// GetHistoryRetention gc.historyRetention 事件和执行记录的保留时间 由leader定时清理 默认168h
+func GetHistoryRetention() time.Duration {
+	retention := Viper.GetDuration("gc.historyRetention")
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+	return retention
+}
@@ -5,10 +5,25 @@ type ReportStatusReq struct {
 	Pid        int    `json:"pid"`
 	ProcessPid int    `json:"processPid"`
 	EventTime  int64  `json:"eventTime"`
+	// EventSeq 同一个supervisor上报的序号 event_time相同时序号大的生效
+	EventSeq   int64  `json:"eventSeq"`
 	Status     string `json:"status"`
 	ErrLog     string `json:"errLog"`
 	CpuPercent int    `json:"cpuPercent"`
 	MemPercent int    `json:"memPercent"`
+	StopReason string `json:"stopReason"`
+	// StopDuration 停止耗时 单位毫秒
+	StopDuration int64 `json:"stopDuration"`
+	// ExitCode 进程退出码 被信号杀死时为-1
+	ExitCode   int    `json:"exitCode"`
+	Signal     string `json:"signal"`
+	CoreDumped bool   `json:"coreDumped"`
+	// Runtime 进程运行时长 单位毫秒
+	Runtime int64 `json:"runtime"`
+	// OutputTail 进程最后的合并输出
+	OutputTail string `json:"outputTail"`
+	// RunStartTime job和cron一次执行的开始时间 不为0时记录执行记录
+	RunStartTime int64 `json:"runStartTime"`
 }
 
 type ServiceVO struct {
@@ -18,4 +33,38 @@ type ServiceVO struct {
 	ServiceStatus string `json:"serviceStatus"`
 	Pid           int    `json:"pid"`
 	AgentHost     string `json:"agentHost"`
+	RestartCount  int    `json:"restartCount"`
+	ReplicaIndex  int    `json:"replicaIndex"`
+	StopReason    string `json:"stopReason"`
+	ExitCode      int    `json:"exitCode"`
+	Signal        string `json:"signal"`
+	CoreDumped    bool   `json:"coreDumped"`
+	Runtime       int64  `json:"runtime"`
+	OutputTail    string `json:"outputTail"`
+	// Orphaned 所在实例已停止心跳
+	Orphaned bool `json:"orphaned"`
+}
+
+// InstanceVO zallet实例 Alive表示心跳未超时
+type InstanceVO struct {
+	InstanceId  string            `json:"instanceId"`
+	LocalIp     string            `json:"localIp"`
+	AgentHost   string            `json:"agentHost"`
+	Version     string            `json:"version"`
+	StartTime   int64             `json:"startTime"`
+	CpuPercent  int               `json:"cpuPercent"`
+	MemPercent  int               `json:"memPercent"`
+	DiskPercent int               `json:"diskPercent"`
+	Labels      map[string]string `json:"labels"`
+	Heartbeat   int64             `json:"heartbeat"`
+	Alive       bool              `json:"alive"`
+	// Leader 持有leader租约
+	Leader bool `json:"leader"`
+}
+
+// StackServiceVO stack中单个服务及其所有副本
+type StackServiceVO struct {
+	Service   string      `json:"service"`
+	DependsOn []string    `json:"dependsOn"`
+	Services  []ServiceVO `json:"services"`
 }
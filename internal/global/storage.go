@@ -0,0 +1,48 @@
+package global
+
+import (
+	"fmt"
+	"log"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"xorm.io/xorm"
+)
+
+// 存储后端由xorm.driver选择 服务元数据通过servicemd.Store读写 mysql和sqlite各有一个实现
+// 新增后端需实现servicemd.Store 表结构通过migrate创建
+const (
+	MysqlDriver  = "mysql"
+	SqliteDriver = "sqlite"
+)
+
+// GetXormDriver xorm.driver 默认mysql 单机可使用sqlite
+func GetXormDriver() string {
+	driver := Viper.GetString("xorm.driver")
+	if driver == "" {
+		driver = MysqlDriver
+	}
+	return driver
+}
+
+// IsEmbeddedStorage 是否使用BaseDir下的sqlite文件存储
+// sqlite只对本机可见 实例心跳 leader选举 全局调度和孤儿清理只在共享同一个mysql的实例间生效
+// 使用sqlite时这些功能只作用于本机
+func IsEmbeddedStorage() bool {
+	return GetXormDriver() == SqliteDriver
+}
+
+// newSqliteEngine xorm.dataSourceName为数据库文件路径 默认BaseDir/zallet.db
+func newSqliteEngine() *xorm.Engine {
+	file := Viper.GetString("xorm.dataSourceName")
+	if file == "" {
+		file = filepath.Join(BaseDir, "zallet.db")
+	}
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", file)
+	x, err := xorm.NewEngine(SqliteDriver, dsn)
+	if err != nil {
+		log.Fatalf("init xorm failed with err:%v", err)
+	}
+	// sqlite只允许单个写入者 避免database is locked
+	x.SetMaxOpenConns(1)
+	return x
+}
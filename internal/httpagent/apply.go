@@ -0,0 +1,189 @@
+package httpagent
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"gopkg.in/yaml.v3"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// readyWaitExtra 等待就绪时在startupTimeout之外额外等待的时间
+	readyWaitExtra = 10 * time.Second
+)
+
+// doApplyAppYaml 声明式应用配置
+// 按name或app+env查找本实例的服务 配置变化则替换 配置不变则不做任何操作 再按副本数新建或删除服务
+func doApplyAppYaml(appYaml process.Yaml, note string) (string, error) {
+	unlock := lockServiceKey(false, appYaml.App, appYaml.Env, appYaml.Name)
+	defer unlock()
+	return applyAppYamlLocked(appYaml, note)
+}
+
+// applyAppYamlLocked 调用方需持有该服务key的锁
+func applyAppYamlLocked(appYaml process.Yaml, note string) (string, error) {
+	services, err := store.ListServiceByKey(global.InstanceId, appYaml.App, appYaml.Env, appYaml.Name)
+	if err != nil {
+		return "", err
+	}
+	ret := make([]string, 0, len(services))
+	changed := false
+	replicas := appYaml.GetReplicas()
+	if len(services) > replicas {
+		keep, remove := splitReplicas(services, replicas)
+		removed, err := removeReplicas(remove)
+		ret = append(ret, removed...)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+		services = keep
+		changed = true
+	}
+	for _, srv := range services {
+		if appYaml.Equal(srv.AppYaml) {
+			ret = append(ret, srv.ServiceId+" unchanged")
+			continue
+		}
+		serviceId, err := replaceService(srv, appYaml)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+		changed = true
+		if serviceId == srv.ServiceId {
+			log.Printf("apply service: %s replaced", srv.ServiceId)
+			ret = append(ret, srv.ServiceId+" replaced")
+		} else {
+			log.Printf("apply service: %s replaced by %s", srv.ServiceId, serviceId)
+			ret = append(ret, fmt.Sprintf("%s replaced by %s", srv.ServiceId, serviceId))
+		}
+	}
+	if len(services) < replicas {
+		created, err := addReplicas(appYaml, services, replicas-len(services))
+		ret = append(ret, created...)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+		changed = true
+	}
+	if changed {
+		err = insertRevision(appYaml, note)
+	}
+	return strings.Join(ret, "\n"), err
+}
+
+// replaceService 使用新配置替换服务 返回替换后的serviceId
+// recreate保持serviceId不变 startFirst会新建服务
+func replaceService(srv servicemd.Service, appYaml process.Yaml) (string, error) {
+	if appYaml.UpdateStrategy == process.StartFirstUpdateStrategy {
+		return startFirstReplace(srv, appYaml)
+	}
+	if isSupervisorAlive(srv.Pid) {
+		return srv.ServiceId, reloadLocalService(srv.ServiceId, appYaml)
+	}
+	// supervisor已不存在 更新配置后重新拉起
+	_, err := store.UpdateServiceAppYaml(srv.ServiceId, &appYaml)
+	if err != nil {
+		return "", err
+	}
+	srv.AppYaml = &appYaml
+	return srv.ServiceId, respawnService(srv)
+}
+
+// startFirstReplace 先启动新服务 就绪后再停止并删除旧服务 新服务未能就绪时删除新服务 旧服务不受影响
+func startFirstReplace(srv servicemd.Service, appYaml process.Yaml) (string, error) {
+	serviceId, err := createService(appYaml, srv.ReplicaIndex)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("start first: %s started to replace %s", serviceId, srv.ServiceId)
+	err = waitServiceReady(serviceId, appYaml)
+	if err != nil {
+		log.Printf("start first: %s is not ready with err: %v, roll back", serviceId, err)
+		if _, err2 := doDeleteService(serviceId); err2 != nil {
+			log.Printf("start first: delete %s failed with err: %v", serviceId, err2)
+		}
+		return "", fmt.Errorf("%s is not ready and rolled back: %v", serviceId, err)
+	}
+	if err = stopAndDeleteService(srv.ServiceId); err != nil {
+		return "", err
+	}
+	return serviceId, nil
+}
+
+// waitServiceReady 等待服务通过就绪探针
+func waitServiceReady(serviceId string, appYaml process.Yaml) error {
+	deadline := time.Now().Add(appYaml.GetStartupTimeout() + readyWaitExtra)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		srv, b, err := store.GetServiceByServiceId(serviceId)
+		if err != nil {
+			return err
+		}
+		if !b {
+			return fmt.Errorf("%s is not found", serviceId)
+		}
+		switch process.Status(srv.ServiceStatus) {
+		case process.RunningStatus, process.SucceededStatus, process.ScheduledStatus:
+			return nil
+		case process.CrashLoopStatus:
+			return errors.New("service is in crashLoop")
+		case process.StoppedStatus:
+			var exitErr error
+			if srv.ErrLog != "" {
+				exitErr = errors.New(srv.ErrLog)
+			}
+			// 不会被重启 无需继续等待
+			if !appYaml.Restart.ShouldRestart(exitErr) {
+				return fmt.Errorf("service stopped: %s", srv.ErrLog)
+			}
+		}
+	}
+	return errors.New("wait for ready timeout")
+}
+
+// doApplyDryRun 不做任何变更 返回已保存的配置和新配置的差异
+func doApplyDryRun(appYaml process.Yaml) (string, error) {
+	services, err := store.ListServiceByKey(global.InstanceId, appYaml.App, appYaml.Env, appYaml.Name)
+	if err != nil {
+		return "", err
+	}
+	newContent, err := yaml.Marshal(appYaml)
+	if err != nil {
+		return "", err
+	}
+	ret := make([]string, 0)
+	replicas := appYaml.GetReplicas()
+	if len(services) > replicas {
+		keep, remove := splitReplicas(services, replicas)
+		for _, srv := range remove {
+			ret = append(ret, fmt.Sprintf("%s will be removed", srv.ServiceId))
+		}
+		services = keep
+	}
+	for _, srv := range services {
+		if appYaml.Equal(srv.AppYaml) {
+			ret = append(ret, fmt.Sprintf("%s no changes", srv.ServiceId))
+			continue
+		}
+		var oldContent []byte
+		if srv.AppYaml != nil {
+			oldContent, err = yaml.Marshal(srv.AppYaml)
+			if err != nil {
+				return "", err
+			}
+		}
+		ret = append(ret, fmt.Sprintf("%s will be replaced", srv.ServiceId))
+		ret = append(ret, util.DiffLines(string(oldContent), string(newContent))...)
+	}
+	if len(services) < replicas {
+		ret = append(ret, fmt.Sprintf("%d new service will be created", replicas-len(services)))
+		ret = append(ret, util.DiffLines("", string(newContent))...)
+	}
+	return strings.Join(ret, "\n"), nil
+}
@@ -0,0 +1,46 @@
+package httpagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/util"
+	"io"
+	"net/http"
+)
+
+// callSupervisor 通过控制通道调用supervisor
+func callSupervisor(serviceId, method, op string, req, resp any) error {
+	httpClient := util.NewUnixHttpClient(process.ControlSockFile(global.BaseDir, serviceId))
+	defer httpClient.CloseIdleConnections()
+	var body io.Reader
+	if req != nil {
+		m, _ := json.Marshal(req)
+		body = bytes.NewReader(m)
+	}
+	request, err := http.NewRequest(method, "http://fake/api/v1/"+op, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		request.Header.Set("Content-Type", "application/json;charset=utf-8")
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("supervisor return http request statusCode: %v resp: %v", response.StatusCode, string(message))
+	}
+	if resp != nil {
+		return json.Unmarshal(message, resp)
+	}
+	return nil
+}
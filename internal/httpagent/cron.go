@@ -0,0 +1,102 @@
+package httpagent
+
+import (
+	"context"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CronScheduler struct {
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+}
+
+func (s *CronScheduler) Shutdown() {
+	s.cancelFunc()
+	<-s.done
+}
+
+// StartCronScheduler 每分钟检查本实例的本地定时任务 命中schedule时通知supervisor执行
+func StartCronScheduler() *CronScheduler {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ret := &CronScheduler{
+		cancelFunc: cancelFunc,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(ret.done)
+		runEveryMinute(ctx, triggerCronServices)
+	}()
+	return ret
+}
+
+// runEveryMinute 对齐到每分钟执行 直到ctx被取消
+func runEveryMinute(ctx context.Context, fn func(time.Time)) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		fn(next)
+	}
+}
+
+func triggerCronServices(t time.Time) {
+	services, err := store.ListServiceByInstanceId(global.InstanceId)
+	if err != nil {
+		log.Printf("list cron services failed with err: %v", err)
+		return
+	}
+	for _, srv := range services {
+		// 全局调度的定时任务由leader触发
+		if srv.Source == servicemd.GlobalSource || !isCronActive(srv) {
+			continue
+		}
+		schedule, err := util.ParseCron(srv.AppYaml.Schedule)
+		if err != nil || !schedule.Match(t) {
+			continue
+		}
+		go triggerCronService(srv.ServiceId)
+	}
+}
+
+// isCronActive 定时任务被kill后状态为停止 不再触发
+func isCronActive(srv servicemd.Service) bool {
+	if srv.AppYaml == nil || srv.AppYaml.GetType() != process.CronServiceType {
+		return false
+	}
+	switch process.Status(srv.ServiceStatus) {
+	case process.StoppedStatus, process.CrashLoopStatus:
+		return false
+	}
+	return true
+}
+
+func triggerCronService(serviceId string) {
+	err := callSupervisor(serviceId, http.MethodPut, "run", nil, nil)
+	if err == nil {
+		log.Printf("trigger cron service: %s", serviceId)
+		return
+	}
+	// 上次执行未结束 跳过本次
+	if strings.Contains(err.Error(), process.ErrRunOverlap.Error()) {
+		log.Printf("skip cron service: %s because previous run is still running", serviceId)
+		return
+	}
+	if strings.Contains(err.Error(), process.ErrRunSuspended.Error()) {
+		log.Printf("skip cron service: %s because it is killed", serviceId)
+		return
+	}
+	log.Printf("trigger cron service: %s failed with err: %v", serviceId, err)
+}
@@ -0,0 +1,137 @@
+package httpagent
+
+import (
+	"context"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"log"
+	"time"
+)
+
+const (
+	heartbeatInterval = 10 * time.Second
+	// instanceDeadTimeout 超过该时间没有心跳认为实例已不存在
+	instanceDeadTimeout = 3 * heartbeatInterval
+)
+
+type Heartbeater struct {
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+}
+
+func (h *Heartbeater) Shutdown() {
+	h.cancelFunc()
+	<-h.done
+}
+
+// StartHeartbeat 定时上报实例信息和主机负载
+func StartHeartbeat() *Heartbeater {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ret := &Heartbeater{
+		cancelFunc: cancelFunc,
+		done:       make(chan struct{}),
+	}
+	startTime := time.Now().UnixMilli()
+	go func() {
+		defer close(ret.done)
+		for {
+			if err := heartbeat(startTime); err != nil {
+				log.Printf("heartbeat failed with err: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(heartbeatInterval):
+			}
+		}
+	}()
+	return ret
+}
+
+func heartbeat(startTime int64) error {
+	instance := &servicemd.Instance{
+		InstanceId: global.InstanceId,
+		LocalIp:    global.LocalIp,
+		AgentHost:  getAgentHost(),
+		Version:    global.Version,
+		StartTime:  startTime,
+		Labels:     global.GetInstanceLabels(),
+	}
+	if percents, err := cpu.Percent(time.Second, false); err == nil && len(percents) > 0 {
+		instance.CpuPercent = int(percents[0])
+	}
+	if stat, err := mem.VirtualMemory(); err == nil {
+		instance.MemPercent = int(stat.UsedPercent)
+	}
+	if stat, err := disk.Usage(global.BaseDir); err == nil {
+		instance.DiskPercent = int(stat.UsedPercent)
+	}
+	// 使用数据库时间 放在最后 采集负载耗时不影响心跳时间
+	now, err := store.NowMilli()
+	if err != nil {
+		return err
+	}
+	instance.Heartbeat = now
+	return store.UpsertInstance(instance)
+}
+
+// isInstanceAlive 心跳未超时 now为数据库时间
+func isInstanceAlive(instance servicemd.Instance, now int64) bool {
+	return now-instance.Heartbeat < instanceDeadTimeout.Milliseconds()
+}
+
+func doListInstances() ([]global.InstanceVO, error) {
+	instances, err := store.ListInstance()
+	if err != nil {
+		return nil, err
+	}
+	now, err := store.NowMilli()
+	if err != nil {
+		return nil, err
+	}
+	// 最近一次竞选时观察到的leader
+	leader := ""
+	if fleetElector != nil {
+		leader = fleetElector.GetLeader()
+	}
+	ret := make([]global.InstanceVO, 0, len(instances))
+	for _, md := range instances {
+		ret = append(ret, global.InstanceVO{
+			InstanceId:  md.InstanceId,
+			LocalIp:     md.LocalIp,
+			AgentHost:   md.AgentHost,
+			Version:     md.Version,
+			StartTime:   md.StartTime,
+			CpuPercent:  md.CpuPercent,
+			MemPercent:  md.MemPercent,
+			DiskPercent: md.DiskPercent,
+			Labels:      md.Labels,
+			Heartbeat:   md.Heartbeat,
+			Alive:       isInstanceAlive(md, now),
+			Leader:      md.InstanceId == leader,
+		})
+	}
+	return ret, nil
+}
+
+// listAliveInstanceIds 心跳未超时的实例
+func listAliveInstanceIds() (map[string]bool, error) {
+	instances, err := store.ListInstance()
+	if err != nil {
+		return nil, err
+	}
+	now, err := store.NowMilli()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool, len(instances))
+	for _, md := range instances {
+		if isInstanceAlive(md, now) {
+			ret[md.InstanceId] = true
+		}
+	}
+	return ret, nil
+}
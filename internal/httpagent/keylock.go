@@ -0,0 +1,53 @@
+package httpagent
+
+import (
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"sync"
+)
+
+// keyLocker 按服务key加锁 apply reconcile和scale对同一服务串行执行
+type keyLocker struct {
+	sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+var serviceKeyLocker = &keyLocker{
+	locks: make(map[string]*keyLock),
+}
+
+// lock 返回解锁函数 没有等待者时释放该key的锁
+func (l *keyLocker) lock(key string) func() {
+	l.Lock()
+	kl, b := l.locks[key]
+	if !b {
+		kl = new(keyLock)
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.Unlock()
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+		l.Lock()
+		kl.refs--
+		if kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.Unlock()
+	}
+}
+
+// lockServiceKey 本实例服务和全局调度的服务分开加锁
+func lockServiceKey(global bool, app, env, name string) func() {
+	key := process.ServiceKey(app, env, name)
+	if global {
+		key = servicemd.GlobalSource + ":" + key
+	}
+	return serviceKeyLocker.lock(key)
+}
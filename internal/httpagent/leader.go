@@ -0,0 +1,213 @@
+package httpagent
+
+import (
+	"context"
+	"github.com/LeeZXin/zallet/internal/election"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// fleetLeaseName 所有实例竞选同一个租约
+	fleetLeaseName = "fleet"
+	leaseDuration  = 15 * time.Second
+	leaseRetry     = 5 * time.Second
+)
+
+// fleetElector 用于查询当前leader
+var fleetElector *election.Elector
+
+// StartLeaderElection 竞选leader 只有leader执行释放服务 清理数据和触发全局定时任务
+func StartLeaderElection() *election.Elector {
+	fleetElector = election.Start(global.Xengine, election.Config{
+		Name:          fleetLeaseName,
+		Identity:      global.InstanceId,
+		LeaseDuration: leaseDuration,
+		RetryPeriod:   leaseRetry,
+		Callbacks: election.Callbacks{
+			OnStartedLeading: leadFleet,
+			OnStoppedLeading: func() {
+				log.Println("stopped leading")
+			},
+			OnNewLeader: func(identity string) {
+				log.Printf("new leader: %s", identity)
+			},
+		},
+	})
+	return fleetElector
+}
+
+func leadFleet(ctx context.Context) {
+	log.Println("started leading")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for {
+			runFleetChores()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(placementInterval):
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		runEveryMinute(ctx, triggerGlobalCronServices)
+	}()
+	wg.Wait()
+}
+
+func runFleetChores() {
+	if err := releaseDeadServices(); err != nil {
+		log.Printf("release dead services failed with err: %v", err)
+	}
+	if err := gcOrphanedRows(); err != nil {
+		log.Printf("gc orphaned rows failed with err: %v", err)
+	}
+	if err := gcHistoryRows(); err != nil {
+		log.Printf("gc history rows failed with err: %v", err)
+	}
+}
+
+// gcOrphanedRows 删除停止心跳超过gc.orphanTimeout的实例 其本地服务标记为停止
+// 服务记录不删除 实例恢复后仍可接管存活的supervisor
+func gcOrphanedRows() error {
+	instances, err := store.ListInstance()
+	if err != nil {
+		return err
+	}
+	now, err := store.NowMilli()
+	if err != nil {
+		return err
+	}
+	timeout := global.GetOrphanGcTimeout()
+	for _, md := range instances {
+		if now-md.Heartbeat < timeout.Milliseconds() {
+			continue
+		}
+		services, err := store.ListServiceByInstanceId(md.InstanceId)
+		if err != nil {
+			return err
+		}
+		marked := 0
+		for _, srv := range services {
+			// 全局调度的服务已由releaseDeadServices释放
+			if srv.Source == servicemd.GlobalSource {
+				continue
+			}
+			switch process.Status(srv.ServiceStatus) {
+			case process.StoppedStatus, process.SucceededStatus, process.CrashLoopStatus:
+				continue
+			}
+			if err = markServiceLost(srv, now); err != nil {
+				return err
+			}
+			marked++
+		}
+		if _, err = store.DeleteInstance(md.InstanceId); err != nil {
+			return err
+		}
+		log.Printf("gc instance: %s and mark %d services stopped", md.InstanceId, marked)
+	}
+	return nil
+}
+
+func markServiceLost(srv servicemd.Service, now int64) error {
+	_, err := store.MarkServiceLost(srv.ServiceId, string(process.InstanceLostStopReason))
+	if err != nil {
+		return err
+	}
+	return store.InsertServiceEvent(&servicemd.ServiceEvent{
+		ServiceId:  srv.ServiceId,
+		InstanceId: srv.InstanceId,
+		App:        srv.App,
+		Env:        srv.Env,
+		Status:     string(process.StoppedStatus),
+		StopReason: string(process.InstanceLostStopReason),
+		EventTime:  now,
+	})
+}
+
+// gcHistoryRows 删除超过gc.historyRetention的事件和执行记录
+func gcHistoryRows() error {
+	now, err := store.NowMilli()
+	if err != nil {
+		return err
+	}
+	before := now - global.GetHistoryRetention().Milliseconds()
+	events, err := store.DeleteServiceEventBefore(before)
+	if err != nil {
+		return err
+	}
+	runs, err := store.DeleteServiceRunBefore(before)
+	if err != nil {
+		return err
+	}
+	if events > 0 || runs > 0 {
+		log.Printf("gc %d events and %d runs", events, runs)
+	}
+	return nil
+}
+
+// triggerGlobalCronServices 每个全局定时任务只在一个存活的副本上执行
+// 通过标记run由所在实例执行 最多延迟一个调度周期
+func triggerGlobalCronServices(t time.Time) {
+	services, err := store.ListGlobalService()
+	if err != nil {
+		log.Printf("list global services failed with err: %v", err)
+		return
+	}
+	alive, err := listAliveInstanceIds()
+	if err != nil {
+		log.Printf("list alive instances failed with err: %v", err)
+		return
+	}
+	// 按服务分组 已按副本序号排序
+	groups := make(map[string][]servicemd.Service)
+	keys := make([]string, 0)
+	for _, srv := range services {
+		if srv.AppYaml == nil || srv.AppYaml.GetType() != process.CronServiceType {
+			continue
+		}
+		key := srv.App + "/" + srv.Env + "/" + srv.Name
+		if _, b := groups[key]; !b {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], srv)
+	}
+	for _, key := range keys {
+		replicas := groups[key]
+		schedule, err := util.ParseCron(replicas[0].AppYaml.Schedule)
+		if err != nil || !schedule.Match(t) {
+			continue
+		}
+		if !markCronRun(replicas, alive) {
+			log.Printf("skip global cron service: %s because no replica is available", key)
+		}
+	}
+}
+
+func markCronRun(replicas []servicemd.Service, alive map[string]bool) bool {
+	for _, srv := range replicas {
+		if !alive[srv.InstanceId] || !isCronActive(srv) {
+			continue
+		}
+		b, err := store.MarkServiceAction(srv.ServiceId, servicemd.RunAction)
+		if err != nil {
+			log.Printf("mark service: %s run failed with err: %v", srv.ServiceId, err)
+			continue
+		}
+		if b {
+			log.Printf("trigger global cron service: %s on instance: %s", srv.ServiceId, srv.InstanceId)
+			return true
+		}
+	}
+	return false
+}
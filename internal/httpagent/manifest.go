@@ -0,0 +1,178 @@
+package httpagent
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/fsnotify/fsnotify"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	manifestDebounce       = time.Second
+	manifestResyncInterval = time.Minute
+)
+
+var (
+	reconcileLocker sync.Mutex
+)
+
+// doReconcile 使本实例来自source的服务与配置一致 prune为true时删除配置中已不存在的服务
+func doReconcile(source string, yamls []process.Yaml, prune bool) (string, error) {
+	if source == "" {
+		return "", errors.New("invalid source")
+	}
+	reconcileLocker.Lock()
+	defer reconcileLocker.Unlock()
+	ret := make([]string, 0)
+	keys := make(map[string]bool, len(yamls))
+	for _, y := range yamls {
+		if keys[y.Key()] {
+			return strings.Join(ret, "\n"), fmt.Errorf("%s is duplicated", y.Key())
+		}
+		keys[y.Key()] = true
+		msg, err := reconcileAppYaml(source, y)
+		if msg != "" {
+			ret = append(ret, msg)
+		}
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+	}
+	if !prune {
+		return strings.Join(ret, "\n"), nil
+	}
+	services, err := store.ListServiceBySource(global.InstanceId, source)
+	if err != nil {
+		return strings.Join(ret, "\n"), err
+	}
+	for _, srv := range services {
+		key := process.ServiceKey(srv.App, srv.Env, srv.Name)
+		if keys[key] {
+			continue
+		}
+		keys[key] = true
+		removed, err := removeServicesByKey(srv.App, srv.Env, srv.Name, source)
+		ret = append(ret, removed...)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+	}
+	return strings.Join(ret, "\n"), nil
+}
+
+// reconcileAppYaml 应用配置并记录来源 持有服务key的锁 避免与apply和scale交错
+func reconcileAppYaml(source string, y process.Yaml) (string, error) {
+	unlock := lockServiceKey(false, y.App, y.Env, y.Name)
+	defer unlock()
+	msg, err := applyAppYamlLocked(y, "reconcile "+source)
+	if err != nil {
+		return msg, fmt.Errorf("apply %s failed: %v", y.Key(), err)
+	}
+	_, err = store.UpdateServiceSourceByKey(global.InstanceId, y.App, y.Env, y.Name, source)
+	return msg, err
+}
+
+// reconcileManifests 按目录中的配置文件调整服务 有无效文件时不删除服务 防止误删
+func reconcileManifests(dir string) {
+	manifests, err := process.ReadManifestDir(dir)
+	if err != nil {
+		log.Printf("read manifests: %s failed with err: %v", dir, err)
+		return
+	}
+	yamls := make([]process.Yaml, 0, len(manifests))
+	prune := true
+	for _, m := range manifests {
+		if m.Err != nil {
+			log.Printf("invalid manifest: %s err: %v", m.File, m.Err)
+			prune = false
+			continue
+		}
+		yamls = append(yamls, m.Yaml)
+	}
+	msg, err := doReconcile(dir, yamls, prune)
+	if err != nil {
+		log.Printf("reconcile manifests: %s failed with err: %v", dir, err)
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		// 未变化的服务不打印
+		if line != "" && !strings.HasSuffix(line, " unchanged") {
+			log.Printf("reconcile manifests: %s", line)
+		}
+	}
+}
+
+type ManifestWatcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+func (w *ManifestWatcher) Shutdown() {
+	if w == nil {
+		return
+	}
+	w.watcher.Close()
+	<-w.done
+}
+
+// WatchManifests 监听配置目录 文件变化或定时调整服务
+func WatchManifests() *ManifestWatcher {
+	if !global.IsManifestsWatchEnabled() {
+		return nil
+	}
+	dir := global.GetManifestsDir()
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		log.Printf("mkdir manifests: %s failed with err: %v", dir, err)
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("watch manifests: %s failed with err: %v", dir, err)
+		return nil
+	}
+	err = watcher.Add(dir)
+	if err != nil {
+		watcher.Close()
+		log.Printf("watch manifests: %s failed with err: %v", dir, err)
+		return nil
+	}
+	log.Printf("watch manifests: %s", dir)
+	ret := &ManifestWatcher{
+		watcher: watcher,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(ret.done)
+		reconcileManifests(dir)
+		// 编辑器保存文件会产生多个事件 合并后再处理
+		debounce := time.NewTimer(manifestDebounce)
+		debounce.Stop()
+		ticker := time.NewTicker(manifestResyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce.Reset(manifestDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("watch manifests: %s err: %v", dir, err)
+			case <-debounce.C:
+				reconcileManifests(dir)
+			case <-ticker.C:
+				reconcileManifests(dir)
+			}
+		}
+	}()
+	return ret
+}
@@ -0,0 +1,320 @@
+package httpagent
+
+import (
+	"context"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/util"
+	"log"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	placementInterval = 10 * time.Second
+)
+
+// doApplyGlobal 只记录期望的服务 由满足条件的实例认领后启动
+// 已认领的服务配置变化或需要删除时 标记后由所在实例执行
+func doApplyGlobal(appYaml process.Yaml, note string) (string, error) {
+	unlock := lockServiceKey(true, appYaml.App, appYaml.Env, appYaml.Name)
+	defer unlock()
+	services, err := store.ListGlobalServiceByKey(appYaml.App, appYaml.Env, appYaml.Name)
+	if err != nil {
+		return "", err
+	}
+	ret := make([]string, 0, len(services))
+	changed := false
+	replicas := appYaml.GetReplicas()
+	if len(services) > replicas {
+		for _, srv := range services[replicas:] {
+			if srv.InstanceId == "" {
+				_, err = store.DeleteServiceByServiceId(srv.ServiceId)
+				if err != nil {
+					return strings.Join(ret, "\n"), err
+				}
+				ret = append(ret, srv.ServiceId+" removed")
+				continue
+			}
+			_, err = store.UpdateServiceAction(srv.ServiceId, servicemd.DeleteAction)
+			if err != nil {
+				return strings.Join(ret, "\n"), err
+			}
+			ret = append(ret, fmt.Sprintf("%s will be removed by %s", srv.ServiceId, srv.InstanceId))
+		}
+		services = services[:replicas]
+		changed = true
+	}
+	used := make(map[int]bool, len(services))
+	for _, srv := range services {
+		used[srv.ReplicaIndex] = true
+		if appYaml.Equal(srv.AppYaml) {
+			ret = append(ret, srv.ServiceId+" unchanged")
+			continue
+		}
+		action := ""
+		if srv.InstanceId != "" {
+			action = servicemd.ReloadAction
+		}
+		_, err = store.UpdateServiceAppYamlAndAction(srv.ServiceId, &appYaml, action)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+		changed = true
+		ret = append(ret, srv.ServiceId+" updated")
+	}
+	for index := 0; len(services) < replicas; index++ {
+		if used[index] {
+			continue
+		}
+		md := &servicemd.Service{
+			ServiceId:     util.RandomUuid()[:16],
+			ServiceStatus: string(process.PendingStatus),
+			App:           appYaml.App,
+			Name:          appYaml.Name,
+			ReplicaIndex:  index,
+			Source:        servicemd.GlobalSource,
+			AppYaml:       &appYaml,
+			Env:           appYaml.Env,
+		}
+		if err = store.InsertService(md); err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+		services = append(services, *md)
+		changed = true
+		log.Printf("apply global service: %s index: %d", md.ServiceId, index)
+		ret = append(ret, md.ServiceId+" pending")
+	}
+	if changed {
+		err = insertRevision(appYaml, note)
+	}
+	return strings.Join(ret, "\n"), err
+}
+
+type Placer struct {
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+}
+
+func (p *Placer) Shutdown() {
+	p.cancelFunc()
+	<-p.done
+}
+
+// StartPlacement 定时处理全局调度的服务
+func StartPlacement() *Placer {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	ret := &Placer{
+		cancelFunc: cancelFunc,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(ret.done)
+		for {
+			runPlacement()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(placementInterval):
+			}
+		}
+	}()
+	return ret
+}
+
+func runPlacement() {
+	if err := handleServiceActions(); err != nil {
+		log.Printf("handle service actions failed with err: %v", err)
+	}
+	if err := claimPendingServices(); err != nil {
+		log.Printf("claim pending services failed with err: %v", err)
+	}
+}
+
+// handleServiceActions 执行本实例服务上标记的操作
+func handleServiceActions() error {
+	services, err := store.ListServiceWithAction(global.InstanceId)
+	if err != nil {
+		return err
+	}
+	for _, srv := range services {
+		switch srv.Action {
+		case servicemd.DeleteAction:
+			err = stopAndDeleteService(srv.ServiceId)
+		case servicemd.ReloadAction:
+			err = reloadClaimedService(srv)
+		case servicemd.RunAction:
+			// 先清除标记 避免重复执行
+			if _, err = store.UpdateServiceAction(srv.ServiceId, ""); err == nil {
+				go triggerCronService(srv.ServiceId)
+			}
+		default:
+			_, err = store.UpdateServiceAction(srv.ServiceId, "")
+		}
+		if err != nil {
+			log.Printf("%s service: %s failed with err: %v", srv.Action, srv.ServiceId, err)
+		} else {
+			log.Printf("%s service: %s", srv.Action, srv.ServiceId)
+		}
+	}
+	return nil
+}
+
+// reloadClaimedService 新配置的标签不再匹配时释放服务 由其他实例认领
+func reloadClaimedService(srv servicemd.Service) error {
+	if srv.AppYaml == nil {
+		return fmt.Errorf("%s has no yaml", srv.ServiceId)
+	}
+	if !matchSelector(srv.AppYaml.Selector, global.GetInstanceLabels()) {
+		_, err := store.ReleaseService(srv.ServiceId, global.InstanceId)
+		if err != nil {
+			return err
+		}
+		if isSupervisorAlive(srv.Pid) {
+			return util.TerminateNegativePid(srv.Pid, syscall.SIGTERM, supervisorStopTimeout(srv))
+		}
+		return nil
+	}
+	var err error
+	if isSupervisorAlive(srv.Pid) {
+		err = callSupervisor(srv.ServiceId, http.MethodPut, "reload", *srv.AppYaml, nil)
+	} else {
+		err = respawnService(srv)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = store.UpdateServiceAction(srv.ServiceId, "")
+	return err
+}
+
+// releaseDeadServices 所在实例停止心跳后释放服务 等待删除的直接删除 只在leader上执行
+func releaseDeadServices() error {
+	services, err := store.ListClaimedService()
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return nil
+	}
+	alive, err := listAliveInstanceIds()
+	if err != nil {
+		return err
+	}
+	for _, srv := range services {
+		if alive[srv.InstanceId] || srv.InstanceId == global.InstanceId {
+			continue
+		}
+		if srv.Action == servicemd.DeleteAction {
+			_, err = store.DeleteServiceByServiceId(srv.ServiceId)
+		} else {
+			_, err = store.ReleaseService(srv.ServiceId, srv.InstanceId)
+		}
+		if err != nil {
+			log.Printf("release service: %s failed with err: %v", srv.ServiceId, err)
+			continue
+		}
+		log.Printf("release service: %s because instance: %s is dead", srv.ServiceId, srv.InstanceId)
+	}
+	return nil
+}
+
+// claimPendingServices 本实例是负载最低的可用实例时认领服务并启动
+func claimPendingServices() error {
+	services, err := store.ListPendingService()
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return nil
+	}
+	instances, err := store.ListInstance()
+	if err != nil {
+		return err
+	}
+	counts, err := store.CountServiceByInstance()
+	if err != nil {
+		return err
+	}
+	now, err := store.NowMilli()
+	if err != nil {
+		return err
+	}
+	for _, srv := range services {
+		if srv.AppYaml == nil {
+			continue
+		}
+		if pickInstance(srv.AppYaml.Selector, instances, counts, now) != global.InstanceId {
+			continue
+		}
+		b, err := store.ClaimService(time.Now().UnixMilli(), srv.ServiceId, global.InstanceId, getAgentHost(), global.SshToken)
+		if err != nil {
+			return err
+		}
+		if !b {
+			// 已被其他实例认领
+			continue
+		}
+		counts[global.InstanceId] += 1
+		log.Printf("claim service: %s", srv.ServiceId)
+		srv.InstanceId = global.InstanceId
+		if err = respawnService(srv); err != nil {
+			log.Printf("start claimed service: %s failed with err: %v", srv.ServiceId, err)
+			if _, err = store.ReleaseService(srv.ServiceId, global.InstanceId); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pickInstance 在标签匹配且有剩余容量的存活实例中 选择服务数最少的 其次内存使用率最低的
+func pickInstance(selector map[string]string, instances []servicemd.Instance, counts map[string]int, now int64) string {
+	maxServices := global.GetPlacementMaxServices()
+	maxPercent := global.GetPlacementMaxPercent()
+	var best *servicemd.Instance
+	for i := range instances {
+		instance := &instances[i]
+		if !isInstanceAlive(*instance, now) || !matchSelector(selector, instance.Labels) {
+			continue
+		}
+		if maxServices > 0 && counts[instance.InstanceId] >= maxServices {
+			continue
+		}
+		if instance.CpuPercent >= maxPercent || instance.MemPercent >= maxPercent {
+			continue
+		}
+		if best == nil || lessLoaded(instance, best, counts) {
+			best = instance
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.InstanceId
+}
+
+func lessLoaded(a, b *servicemd.Instance, counts map[string]int) bool {
+	if counts[a.InstanceId] != counts[b.InstanceId] {
+		return counts[a.InstanceId] < counts[b.InstanceId]
+	}
+	if a.MemPercent != b.MemPercent {
+		return a.MemPercent < b.MemPercent
+	}
+	return a.InstanceId < b.InstanceId
+}
+
+// matchSelector 标签需全部匹配 selector为空时匹配所有实例
+func matchSelector(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		// 实例标签从配置读取 key为小写
+		if labels[strings.ToLower(k)] != v {
+			return false
+		}
+	}
+	return true
+}
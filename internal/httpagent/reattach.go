@@ -0,0 +1,102 @@
+package httpagent
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	gprocess "github.com/shirou/gopsutil/v3/process"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+var (
+	errSupervisorLost = errors.New("supervisor exited while zallet was down")
+)
+
+// ReattachServices zallet启动时接管本实例的服务
+// supervisor仍存活的无需处理 会自行补报状态
+// supervisor已不存在的 根据重启策略重新拉起或标记为停止
+func ReattachServices() {
+	services, err := store.ListServiceByInstanceId(global.InstanceId)
+	if err != nil {
+		log.Printf("reattach services failed with err: %v", err)
+		return
+	}
+	for _, srv := range services {
+		if isSupervisorAlive(srv.Pid) {
+			log.Printf("reattach service: %s pid: %d", srv.ServiceId, srv.Pid)
+			continue
+		}
+		switch process.Status(srv.ServiceStatus) {
+		case process.StoppedStatus, process.CrashLoopStatus, process.SucceededStatus:
+			// 服务本来就已停止 被kill的定时任务也不再拉起
+			// 实例长时间停止心跳被标记为停止的服务 按重启策略处理
+			if srv.StopReason != string(process.InstanceLostStopReason) {
+				continue
+			}
+		}
+		// 定时任务依赖supervisor执行 未被kill时总是重新拉起
+		if srv.AppYaml != nil && (srv.AppYaml.GetType() == process.CronServiceType || srv.AppYaml.Restart.ShouldRestart(errSupervisorLost)) {
+			if err = respawnService(srv); err != nil {
+				log.Printf("respawn service: %s failed with err: %v", srv.ServiceId, err)
+			}
+			continue
+		}
+		err = doReportStatus(global.ReportStatusReq{
+			ServiceId:  srv.ServiceId,
+			Pid:        srv.Pid,
+			EventTime:  time.Now().UnixMilli(),
+			Status:     string(process.StoppedStatus),
+			ErrLog:     errSupervisorLost.Error(),
+			StopReason: string(process.SupervisorLostStopReason),
+			ExitCode:   -1,
+		})
+		if err != nil {
+			log.Printf("mark service: %s stopped failed with err: %v", srv.ServiceId, err)
+		} else {
+			log.Printf("mark service: %s stopped because supervisor is lost", srv.ServiceId)
+		}
+	}
+}
+
+// respawnService 使用原serviceId重新拉起supervisor
+func respawnService(srv servicemd.Service) error {
+	cmdRet, err := spawnSupervisor(srv.ServiceId, srv.ReplicaIndex, *srv.AppYaml)
+	if err != nil {
+		return err
+	}
+	b, err := store.UpdateServicePid(
+		time.Now().UnixMilli(),
+		srv.ServiceId,
+		cmdRet.GetPid(),
+		string(process.StartingStatus),
+	)
+	if err == nil && !b {
+		err = fmt.Errorf("%s is not found", srv.ServiceId)
+	}
+	if err != nil {
+		cmdRet.Kill()
+		return err
+	}
+	log.Printf("respawn service: %s pid: %d", srv.ServiceId, cmdRet.GetPid())
+	return nil
+}
+
+// isSupervisorAlive 检查pid是否仍是zallet的supervisor进程 防止pid被复用
+func isSupervisorAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	pcs, err := gprocess.NewProcess(int32(pid))
+	if err != nil {
+		return false
+	}
+	args, err := pcs.CmdlineSlice()
+	if err != nil || len(args) < 2 {
+		return false
+	}
+	return args[1] == "service" && filepath.Base(args[0]) == filepath.Base(global.AppPath)
+}
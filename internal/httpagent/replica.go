@@ -0,0 +1,126 @@
+package httpagent
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"log"
+	"sort"
+	"strings"
+)
+
+// addReplicas 新建count个副本 使用未被占用的最小副本序号
+func addReplicas(appYaml process.Yaml, services []servicemd.Service, count int) ([]string, error) {
+	used := make(map[int]bool, len(services))
+	for _, srv := range services {
+		used[srv.ReplicaIndex] = true
+	}
+	ret := make([]string, 0, count)
+	for index := 0; len(ret) < count; index++ {
+		if used[index] {
+			continue
+		}
+		serviceId, err := createService(appYaml, index)
+		if err != nil {
+			return ret, err
+		}
+		log.Printf("add replica: %s index: %d", serviceId, index)
+		ret = append(ret, fmt.Sprintf("%s created", serviceId))
+	}
+	return ret, nil
+}
+
+// splitReplicas 保留副本序号最小的replicas个服务 其余按序号从大到小删除 使剩余副本序号保持0..replicas-1
+func splitReplicas(services []servicemd.Service, replicas int) ([]servicemd.Service, []servicemd.Service) {
+	sorted := make([]servicemd.Service, len(services))
+	copy(sorted, services)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ReplicaIndex != sorted[j].ReplicaIndex {
+			return sorted[i].ReplicaIndex < sorted[j].ReplicaIndex
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+	if len(sorted) <= replicas {
+		return sorted, nil
+	}
+	keep, remove := sorted[:replicas], make([]servicemd.Service, 0, len(sorted)-replicas)
+	for i := len(sorted) - 1; i >= replicas; i-- {
+		remove = append(remove, sorted[i])
+	}
+	return keep, remove
+}
+
+// removeReplicas 按顺序删除副本
+func removeReplicas(services []servicemd.Service) ([]string, error) {
+	ret := make([]string, 0, len(services))
+	for _, srv := range services {
+		if err := stopAndDeleteService(srv.ServiceId); err != nil {
+			return ret, err
+		}
+		log.Printf("remove replica: %s index: %d", srv.ServiceId, srv.ReplicaIndex)
+		ret = append(ret, fmt.Sprintf("%s removed", srv.ServiceId))
+	}
+	return ret, nil
+}
+
+// removeServicesByKey 持有服务key的锁删除本实例的服务 source不为空时只删除该来源的服务
+func removeServicesByKey(app, env, name, source string) ([]string, error) {
+	unlock := lockServiceKey(false, app, env, name)
+	defer unlock()
+	services, err := store.ListServiceByKey(global.InstanceId, app, env, name)
+	if err != nil {
+		return nil, err
+	}
+	if source != "" {
+		filtered := make([]servicemd.Service, 0, len(services))
+		for _, srv := range services {
+			if srv.Source == source {
+				filtered = append(filtered, srv)
+			}
+		}
+		services = filtered
+	}
+	return removeReplicas(services)
+}
+
+// stopAndDeleteService 先优雅停止进程 状态变化可以在ls中看到 再删除服务
+func stopAndDeleteService(serviceId string) error {
+	if err := doKillService(serviceId); err != nil {
+		log.Printf("stop service: %s failed with err: %v", serviceId, err)
+	}
+	_, err := doDeleteService(serviceId)
+	return err
+}
+
+// doScale 调整副本数 以最新副本的配置新建副本
+func doScale(app, env, name string, replicas int) (string, error) {
+	if replicas < 0 {
+		return "", errors.New("invalid replicas")
+	}
+	unlock := lockServiceKey(false, app, env, name)
+	defer unlock()
+	services, err := store.ListServiceByKey(global.InstanceId, app, env, name)
+	if err != nil {
+		return "", err
+	}
+	if len(services) == 0 {
+		return "", errors.New("service is not found")
+	}
+	var ret []string
+	if len(services) > replicas {
+		_, remove := splitReplicas(services, replicas)
+		ret, err = removeReplicas(remove)
+	} else if len(services) < replicas {
+		latest := services[len(services)-1]
+		if latest.AppYaml == nil {
+			return "", fmt.Errorf("%s has no yaml", latest.ServiceId)
+		}
+		ret, err = addReplicas(*latest.AppYaml, services, replicas-len(services))
+	}
+	if len(ret) == 0 && err == nil {
+		return "nothing changed", nil
+	}
+	return strings.Join(ret, "\n"), err
+}
@@ -0,0 +1,80 @@
+package httpagent
+
+import (
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"reflect"
+	"testing"
+)
+
+func TestSplitReplicas(t *testing.T) {
+	// id越大越新 startFirst替换后序号0的副本id最大
+	srv := func(id int64, index int) servicemd.Service {
+		return servicemd.Service{Id: id, ReplicaIndex: index}
+	}
+	indexes := func(services []servicemd.Service) []int {
+		ret := make([]int, 0, len(services))
+		for _, s := range services {
+			ret = append(ret, s.ReplicaIndex)
+		}
+		return ret
+	}
+	tests := []struct {
+		name      string
+		services  []servicemd.Service
+		replicas  int
+		keep      []int
+		remove    []int
+		removeIds []int64
+	}{
+		{
+			name:     "scale down after start first",
+			services: []servicemd.Service{srv(2, 1), srv(3, 2), srv(4, 0)},
+			replicas: 2,
+			keep:     []int{0, 1},
+			remove:   []int{2},
+		},
+		{
+			name:     "remove highest index first",
+			services: []servicemd.Service{srv(1, 0), srv(2, 1), srv(3, 2), srv(4, 3)},
+			replicas: 1,
+			keep:     []int{0},
+			remove:   []int{3, 2, 1},
+		},
+		{
+			name:     "scale to zero",
+			services: []servicemd.Service{srv(5, 1), srv(4, 0)},
+			replicas: 0,
+			keep:     []int{},
+			remove:   []int{1, 0},
+		},
+		{
+			name:     "nothing to remove",
+			services: []servicemd.Service{srv(2, 1), srv(1, 0)},
+			replicas: 3,
+			keep:     []int{0, 1},
+			remove:   []int{},
+		},
+		{
+			name:      "duplicate index keeps the older one",
+			services:  []servicemd.Service{srv(1, 0), srv(2, 0)},
+			replicas:  1,
+			keep:      []int{0},
+			remove:    []int{0},
+			removeIds: []int64{2},
+		},
+	}
+	for _, tt := range tests {
+		keep, remove := splitReplicas(tt.services, tt.replicas)
+		if got := indexes(keep); !reflect.DeepEqual(got, tt.keep) {
+			t.Errorf("%s: keep = %v, want %v", tt.name, got, tt.keep)
+		}
+		if got := indexes(remove); !reflect.DeepEqual(got, tt.remove) {
+			t.Errorf("%s: remove = %v, want %v", tt.name, got, tt.remove)
+		}
+		for i, id := range tt.removeIds {
+			if remove[i].Id != id {
+				t.Errorf("%s: remove[%d].Id = %d, want %d", tt.name, i, remove[i].Id, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package httpagent
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+)
+
+func insertRevision(appYaml process.Yaml, note string) error {
+	return store.InsertServiceRevision(&servicemd.ServiceRevision{
+		App:        appYaml.App,
+		Env:        appYaml.Env,
+		Name:       appYaml.Name,
+		AppYaml:    &appYaml,
+		Note:       note,
+		InstanceId: global.InstanceId,
+	})
+}
+
+func doListRevisions(app, env, name string) ([]servicemd.ServiceRevision, error) {
+	if app == "" && name == "" {
+		return nil, errors.New("invalid app")
+	}
+	return store.ListServiceRevision(app, env, name)
+}
+
+// doRollback 重新应用指定版本的配置 有name时按name查找版本 否则按app+env
+// 本实例已有该服务则重新加载 否则新建服务
+func doRollback(app, env, name string, revision int) error {
+	if app == "" && name == "" {
+		return errors.New("invalid app")
+	}
+	if revision <= 0 {
+		return errors.New("invalid revision")
+	}
+	if name == "" && env == "" {
+		// 未指定env时 app只能有一个env
+		revisions, err := store.ListServiceRevision(app, "", "")
+		if err != nil {
+			return err
+		}
+		for _, r := range revisions {
+			if r.Name != "" {
+				continue
+			}
+			if env != "" && env != r.Env {
+				return errors.New("app has multiple envs, please specify env")
+			}
+			env = r.Env
+		}
+	}
+	target, b, err := store.GetServiceRevision(app, env, name, revision)
+	if err != nil {
+		return err
+	}
+	if !b || target.AppYaml == nil {
+		return fmt.Errorf("revision %d of %s is not found", revision, process.ServiceKey(app, env, name))
+	}
+	_, err = doApplyAppYaml(*target.AppYaml, fmt.Sprintf("rollback to revision %d", revision))
+	return err
+}
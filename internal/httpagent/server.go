@@ -1,8 +1,11 @@
 package httpagent
 
 import (
+	"encoding/json"
 	"github.com/LeeZXin/zallet/internal/global"
 	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"github.com/LeeZXin/zallet/internal/stack"
 	"github.com/LeeZXin/zallet/internal/util"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
@@ -10,6 +13,12 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+)
+
+const (
+	eventsBatchSize = 500
 )
 
 type Server struct {
@@ -50,6 +59,32 @@ func StartServer() *Server {
 		group.POST("/apply", applyAppYaml)
 		// 上报状态
 		group.POST("/reportStatus", reportStatus)
+		// 服务日志
+		group.GET("/logs/:serviceId", serviceLogs)
+		// 重新加载配置
+		group.PUT("/reload/:serviceId", reloadService)
+		// 服务运行状态
+		group.GET("/stats/:serviceId", serviceStats)
+		// 服务状态变化记录
+		group.GET("/events", serviceEvents)
+		// zallet实例
+		group.GET("/instances", listInstances)
+		// job和cron的执行记录
+		group.GET("/runs", serviceRuns)
+		// 配置版本记录
+		group.GET("/history", serviceHistory)
+		// 回滚到指定版本
+		group.PUT("/rollback", rollbackService)
+		// 调整副本数
+		group.PUT("/scale", scaleService)
+		// 启动stack
+		group.POST("/stack/up", stackUp)
+		// 停止stack
+		group.POST("/stack/down", stackDown)
+		// 查询stack
+		group.POST("/stack/ls", stackLs)
+		// 按目录调整服务
+		group.POST("/reconcile", reconcileServices)
 	}
 	log.Printf("http server listen on sock file: %s", global.SockFile)
 	srv := &http.Server{
@@ -118,14 +153,14 @@ func restartService(c *gin.Context) {
 	c.String(http.StatusOK, "ok")
 }
 
-func applyAppYaml(c *gin.Context) {
+func reloadService(c *gin.Context) {
 	var req process.Yaml
 	if util.ShouldBindYAML(&req, c) {
 		if req.IsValid() != nil {
 			c.String(http.StatusBadRequest, "bad request")
 			return
 		}
-		err := doApplyAppYaml(req)
+		err := doReloadService(c.Param("serviceId"), req, c.Query("note"))
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
 			return
@@ -133,3 +168,227 @@ func applyAppYaml(c *gin.Context) {
 		c.String(http.StatusOK, "ok")
 	}
 }
+
+func serviceStats(c *gin.Context) {
+	stats, err := doServiceStats(c.Param("serviceId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func applyAppYaml(c *gin.Context) {
+	var req process.Yaml
+	if util.ShouldBindYAML(&req, c) {
+		if req.IsValid() != nil {
+			c.String(http.StatusBadRequest, "bad request")
+			return
+		}
+		var (
+			msg string
+			err error
+		)
+		if cast.ToBool(c.Query("global")) {
+			msg, err = doApplyGlobal(req, c.Query("note"))
+		} else if cast.ToBool(c.Query("dryRun")) {
+			msg, err = doApplyDryRun(req)
+		} else {
+			msg, err = doApplyAppYaml(req, c.Query("note"))
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, msg)
+	}
+}
+
+func serviceLogs(c *gin.Context) {
+	var since time.Time
+	if c.Query("since") != "" {
+		duration, err := time.ParseDuration(c.Query("since"))
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid since")
+			return
+		}
+		since = time.Now().Add(-duration)
+	}
+	serviceId := c.Param("serviceId")
+	dir, err := getLogDir(serviceId)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	lines, err := process.ReadLogLines(dir, since, cast.ToInt(c.Query("tail")))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/plain;charset=utf-8")
+	for _, line := range lines {
+		c.Writer.WriteString(line + "\n")
+	}
+	c.Writer.Flush()
+	if cast.ToBool(c.Query("follow")) {
+		err = process.FollowLog(c.Request.Context(), dir, c.Writer, c.Writer.Flush)
+		if err != nil {
+			log.Printf("follow %s logs failed with err: %v", serviceId, err)
+		}
+	}
+}
+
+// serviceEvents 每行输出一个json格式的事件 follow时持续输出新事件
+func serviceEvents(c *gin.Context) {
+	req := servicemd.ListServiceEventReq{
+		ServiceId: c.Query("serviceId"),
+		App:       c.Query("app"),
+		Limit:     eventsBatchSize,
+	}
+	if !cast.ToBool(c.Query("global")) {
+		req.InstanceId = global.InstanceId
+	}
+	if c.Query("since") != "" {
+		duration, err := time.ParseDuration(c.Query("since"))
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid since")
+			return
+		}
+		req.Since = time.Now().Add(-duration).UnixMilli()
+	}
+	events, err := doListEvents(req)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "application/x-ndjson;charset=utf-8")
+	follow := cast.ToBool(c.Query("follow"))
+	encoder := json.NewEncoder(c.Writer)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		for _, event := range events {
+			if err = encoder.Encode(event); err != nil {
+				return
+			}
+			req.AfterId = event.Id
+		}
+		c.Writer.Flush()
+		if len(events) < eventsBatchSize {
+			if !follow {
+				return
+			}
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		events, err = doListEvents(req)
+		if err != nil {
+			log.Printf("list events failed with err: %v", err)
+			return
+		}
+	}
+}
+
+func listInstances(c *gin.Context) {
+	instances, err := doListInstances()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, instances)
+}
+
+func serviceRuns(c *gin.Context) {
+	runs, err := doListRuns(c.Query("serviceId"), cast.ToInt(c.Query("limit")))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func serviceHistory(c *gin.Context) {
+	revisions, err := doListRevisions(c.Query("app"), c.Query("env"), c.Query("name"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+func rollbackService(c *gin.Context) {
+	err := doRollback(c.Query("app"), c.Query("env"), c.Query("name"), cast.ToInt(c.Query("revision")))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.String(http.StatusOK, "ok")
+}
+
+func scaleService(c *gin.Context) {
+	msg, err := doScale(c.Query("app"), c.Query("env"), c.Query("name"), cast.ToInt(c.Query("replicas")))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.String(http.StatusOK, msg)
+}
+
+func stackUp(c *gin.Context) {
+	var req stack.Cfg
+	if util.ShouldBindJSON(&req, c) {
+		msg, err := doStackUp(req)
+		if err != nil {
+			c.String(http.StatusInternalServerError, strings.TrimSpace(msg+"\n"+err.Error()))
+			return
+		}
+		c.String(http.StatusOK, msg)
+	}
+}
+
+func stackDown(c *gin.Context) {
+	var req stack.Cfg
+	if util.ShouldBindJSON(&req, c) {
+		msg, err := doStackDown(req)
+		if err != nil {
+			c.String(http.StatusInternalServerError, strings.TrimSpace(msg+"\n"+err.Error()))
+			return
+		}
+		c.String(http.StatusOK, msg)
+	}
+}
+
+func stackLs(c *gin.Context) {
+	var req stack.Cfg
+	if util.ShouldBindJSON(&req, c) {
+		ret, err := doStackLs(req)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, ret)
+	}
+}
+
+func reconcileServices(c *gin.Context) {
+	var req []process.Yaml
+	if util.ShouldBindJSON(&req, c) {
+		for _, y := range req {
+			if y.IsValid() != nil {
+				c.String(http.StatusBadRequest, "bad request")
+				return
+			}
+		}
+		msg, err := doReconcile(c.Query("source"), req, cast.ToBool(c.Query("prune")))
+		if err != nil {
+			c.String(http.StatusInternalServerError, strings.TrimSpace(msg+"\n"+err.Error()))
+			return
+		}
+		c.String(http.StatusOK, msg)
+	}
+}
@@ -11,38 +11,123 @@ import (
 	"github.com/LeeZXin/zallet/internal/servicemd"
 	"github.com/LeeZXin/zallet/internal/util"
 	"log"
+	"net/http"
+	"strings"
+	"syscall"
 	"time"
-	"xorm.io/xorm"
 )
 
-func doReportStatus(req global.ReportStatusReq) {
-	session := global.Xengine.NewSession()
-	defer session.Close()
-	_, err := servicemd.UpdateServiceStatus(
-		session,
+func doReportStatus(req global.ReportStatusReq) error {
+	srv, found, err := store.GetServiceByServiceId(req.ServiceId)
+	if err != nil {
+		log.Printf("getService :%v failed with err: %v", req.ServiceId, err)
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s is not found", req.ServiceId)
+	}
+	// 全局调度的服务已被释放或被其他实例认领 停止本地的supervisor
+	if srv.InstanceId != global.InstanceId {
+		if isSupervisorAlive(req.Pid) {
+			go util.TerminateNegativePid(req.Pid, syscall.SIGTERM, supervisorStopTimeout(srv))
+		}
+		return fmt.Errorf("%s belongs to instance: %s", req.ServiceId, srv.InstanceId)
+	}
+	var exit *servicemd.ServiceExit
+	if req.Status == string(process.StoppedStatus) || req.Status == string(process.SucceededStatus) {
+		exit = &servicemd.ServiceExit{
+			ExitCode:   req.ExitCode,
+			Signal:     req.Signal,
+			CoreDumped: req.CoreDumped,
+			Runtime:    req.Runtime,
+			OutputTail: req.OutputTail,
+		}
+	}
+	b, err := store.UpdateServiceStatus(
 		req.EventTime,
+		req.EventSeq,
 		req.ServiceId,
 		req.Status,
 		req.ErrLog,
 		req.CpuPercent,
 		req.MemPercent,
+		req.StopReason,
+		req.StopDuration,
+		exit,
 	)
 	if err != nil {
 		log.Printf("updateServiceStatus :%v failed with err: %v", req.ServiceId, err)
+		return err
+	}
+	// 状态变化 每次启动 带有错误信息或者补报的历史状态都记录事件
+	// 新建和重新拉起时数据库已是starting 需单独判断
+	if !b || srv.ServiceStatus != req.Status || req.Status == string(process.StartingStatus) || req.ErrLog != "" {
+		err = store.InsertServiceEvent(&servicemd.ServiceEvent{
+			ServiceId:  req.ServiceId,
+			InstanceId: srv.InstanceId,
+			App:        srv.App,
+			Env:        srv.Env,
+			Status:     req.Status,
+			ErrLog:     req.ErrLog,
+			CpuPercent: req.CpuPercent,
+			MemPercent: req.MemPercent,
+			Pid:        req.Pid,
+			ProcessPid: req.ProcessPid,
+			StopReason: req.StopReason,
+			ExitCode:   req.ExitCode,
+			ExitSignal: req.Signal,
+			EventTime:  req.EventTime,
+		})
+		if err != nil {
+			log.Printf("insertServiceEvent :%v failed with err: %v", req.ServiceId, err)
+		}
+	}
+	// 一次执行结束 补报的也需要记录
+	if req.RunStartTime > 0 {
+		err = store.InsertServiceRun(&servicemd.ServiceRun{
+			ServiceId:  req.ServiceId,
+			InstanceId: srv.InstanceId,
+			App:        srv.App,
+			Env:        srv.Env,
+			StartTime:  req.RunStartTime,
+			Duration:   req.Runtime,
+			Status:     req.Status,
+			StopReason: req.StopReason,
+			ExitCode:   req.ExitCode,
+			ExitSignal: req.Signal,
+			ErrLog:     req.ErrLog,
+		})
+		if err != nil {
+			log.Printf("insertServiceRun :%v failed with err: %v", req.ServiceId, err)
+		}
 	}
+	return nil
+}
+
+func getLocalService(serviceId string) (servicemd.Service, error) {
+	srv, b, err := store.GetServiceByServiceIdAndInstanceId(serviceId, global.InstanceId)
+	if err != nil {
+		return servicemd.Service{}, err
+	}
+	if !b {
+		return servicemd.Service{}, fmt.Errorf("%s is not found", serviceId)
+	}
+	return srv, nil
 }
 
 func doKillService(serviceId string) error {
-	session := global.Xengine.NewSession()
-	defer session.Close()
-	srv, b, err := servicemd.GetServiceByServiceIdAndInstanceId(session, serviceId, global.InstanceId)
+	srv, err := getLocalService(serviceId)
 	if err != nil {
 		return err
 	}
-	if !b {
-		return fmt.Errorf("%s is not found", serviceId)
+	// 优先通过控制通道只杀死进程
+	err = callSupervisor(serviceId, http.MethodPut, "kill", nil, nil)
+	if err == nil {
+		log.Printf("kill service: %v process", serviceId)
+		return nil
 	}
-	err = util.KillNegativePid(srv.Pid)
+	log.Printf("kill service: %v through control channel failed with err: %v", serviceId, err)
+	err = util.TerminateNegativePid(srv.Pid, syscall.SIGTERM, supervisorStopTimeout(srv))
 	if err == nil {
 		log.Printf("kill service: %v pid: %v", serviceId, srv.Pid)
 	}
@@ -50,93 +135,208 @@ func doKillService(serviceId string) error {
 }
 
 func doDeleteService(serviceId string) (*process.Yaml, error) {
-	session := global.Xengine.NewSession()
-	defer session.Close()
-	srv, b, err := servicemd.GetServiceByServiceIdAndInstanceId(session, serviceId, global.InstanceId)
+	srv, b, err := store.GetServiceByServiceIdAndInstanceId(serviceId, global.InstanceId)
 	if err != nil {
 		return nil, err
 	}
 	if !b {
 		return nil, fmt.Errorf("%s is not found", serviceId)
 	}
-	_, err = servicemd.DeleteServiceByServiceId(session, serviceId)
+	_, err = store.DeleteServiceByServiceId(serviceId)
 	if err != nil {
 		return nil, err
 	}
-	util.KillNegativePid(srv.Pid)
+	util.TerminateNegativePid(srv.Pid, syscall.SIGTERM, supervisorStopTimeout(srv))
+	util.RemoveAll(process.ServiceDir(global.BaseDir, serviceId))
 	log.Printf("delete service: %v pid: %v", serviceId, srv.Pid)
 	return srv.AppYaml, nil
 }
 
+// supervisorStopTimeout supervisor需要等待服务优雅停止 额外留出时间
+func supervisorStopTimeout(srv servicemd.Service) time.Duration {
+	var cfg *process.StopCfg
+	if srv.AppYaml != nil {
+		cfg = srv.AppYaml.Stop
+	}
+	return cfg.GetTimeout() + 10*time.Second
+}
+
+// getLogDir 只允许读取本实例服务的日志 返回该服务的日志目录
+func getLogDir(serviceId string) (string, error) {
+	if serviceId == "" || serviceId == "." || serviceId == ".." || strings.ContainsAny(serviceId, `/\`) {
+		return "", fmt.Errorf("invalid serviceId: %s", serviceId)
+	}
+	srv, err := getLocalService(serviceId)
+	if err != nil {
+		return "", err
+	}
+	return process.ServiceDir(global.BaseDir, srv.ServiceId), nil
+}
+
+// doRestartService 保持serviceId不变 重启次数加一
 func doRestartService(serviceId string) error {
-	appYaml, err := doDeleteService(serviceId)
+	srv, err := getLocalService(serviceId)
 	if err != nil {
 		return err
 	}
-	if appYaml == nil {
-		return fmt.Errorf("fail to restart service: %v", serviceId)
+	if isSupervisorAlive(srv.Pid) {
+		err = callSupervisor(serviceId, http.MethodPut, "restart", nil, nil)
+	} else if srv.AppYaml == nil {
+		err = fmt.Errorf("fail to restart service: %v", serviceId)
+	} else {
+		// supervisor已不存在 重新拉起
+		err = respawnService(srv)
+	}
+	if err != nil {
+		return err
 	}
-	return doApplyAppYaml(*appYaml)
+	_, err = store.IncrServiceRestartCount(serviceId)
+	log.Printf("restart service: %v", serviceId)
+	return err
 }
 
-func doLsService(appId string, all bool, status string) ([]global.ServiceVO, error) {
-	session := global.Xengine.NewSession()
-	defer session.Close()
-	if !all {
-		session.Where("instance_id = ?", global.InstanceId)
+// doReloadService 更新配置并通知supervisor重新加载
+func doReloadService(serviceId string, appYaml process.Yaml, note string) error {
+	srv, err := getLocalService(serviceId)
+	if err != nil {
+		return err
+	}
+	if srv.App != appYaml.App || srv.Env != appYaml.Env || srv.Name != appYaml.Name {
+		return errors.New("app, env and name can not be changed")
+	}
+	err = reloadLocalService(serviceId, appYaml)
+	if err != nil {
+		return err
+	}
+	return insertRevision(appYaml, note)
+}
+
+// reloadLocalService 通知supervisor重新加载并保存配置
+func reloadLocalService(serviceId string, appYaml process.Yaml) error {
+	err := callSupervisor(serviceId, http.MethodPut, "reload", appYaml, nil)
+	if err != nil {
+		return err
+	}
+	_, err = store.UpdateServiceAppYaml(serviceId, &appYaml)
+	return err
+}
+
+func doServiceStats(serviceId string) (process.Stats, error) {
+	_, err := getLocalService(serviceId)
+	if err != nil {
+		return process.Stats{}, err
+	}
+	var ret process.Stats
+	err = callSupervisor(serviceId, http.MethodGet, "stats", nil, &ret)
+	return ret, err
+}
+
+func doListEvents(req servicemd.ListServiceEventReq) ([]servicemd.ServiceEvent, error) {
+	return store.ListServiceEvent(req)
+}
+
+func doListRuns(serviceId string, limit int) ([]servicemd.ServiceRun, error) {
+	_, b, err := store.GetServiceByServiceId(serviceId)
+	if err != nil {
+		return nil, err
 	}
-	if appId != "" {
-		session.And("app = ?", appId)
+	if !b {
+		return nil, fmt.Errorf("%s is not found", serviceId)
 	}
-	if status != "" {
-		session.And("service_status = ?", status)
+	return store.ListServiceRun(serviceId, limit)
+}
+
+func doLsService(appId string, all bool, status string) ([]global.ServiceVO, error) {
+	instanceId := global.InstanceId
+	if all {
+		instanceId = ""
 	}
-	ret := make([]servicemd.Service, 0)
-	err := session.Desc("created").Find(&ret)
+	ret, err := store.ListService(instanceId, appId, status)
 	if err != nil {
 		return nil, err
 	}
+	var aliveInstances map[string]bool
+	if all {
+		aliveInstances, err = listAliveInstanceIds()
+		if err != nil {
+			return nil, err
+		}
+	}
 	voList := make([]global.ServiceVO, 0, len(ret))
 	for _, md := range ret {
-		voList = append(voList, global.ServiceVO{
-			ServiceId:     md.ServiceId,
-			App:           md.App,
-			Env:           md.Env,
-			ServiceStatus: md.ServiceStatus,
-			Pid:           md.Pid,
-			AgentHost:     md.AgentHost,
-		})
+		vo := toServiceVO(md)
+		// 等待认领的服务没有所在实例
+		if all && md.InstanceId != "" {
+			vo.Orphaned = !aliveInstances[md.InstanceId]
+		}
+		voList = append(voList, vo)
 	}
 	return voList, nil
 }
 
-func doApplyAppYaml(appYaml process.Yaml) error {
-	serviceId := util.RandomUuid()[:16]
-	var cmdRet *reexec.AsyncCommand
+func toServiceVO(md servicemd.Service) global.ServiceVO {
+	return global.ServiceVO{
+		ServiceId:     md.ServiceId,
+		App:           md.App,
+		Env:           md.Env,
+		ServiceStatus: md.ServiceStatus,
+		Pid:           md.Pid,
+		AgentHost:     md.AgentHost,
+		RestartCount:  md.RestartCount,
+		ReplicaIndex:  md.ReplicaIndex,
+		StopReason:    md.StopReason,
+		ExitCode:      md.ExitCode,
+		Signal:        md.ExitSignal,
+		CoreDumped:    md.CoreDumped,
+		Runtime:       md.Runtime,
+		OutputTail:    md.OutputTail,
+	}
+}
+
+// getAgentHost ssh agent地址 未配置时使用本机ip
+func getAgentHost() string {
+	sshHost := global.Viper.GetString("ssh.agent.host")
+	if sshHost == "" {
+		sshHost = fmt.Sprintf("%s:%d", global.LocalIp, global.GetSshAgentPort())
+	}
+	return sshHost
+}
+
+// spawnSupervisor 启动supervisor进程
+func spawnSupervisor(serviceId string, replicaIndex int, appYaml process.Yaml) (*reexec.AsyncCommand, error) {
 	opts := process.ServiceOpts{
-		ServiceId: serviceId,
-		Yaml:      appYaml,
-		BaseDir:   global.BaseDir,
-		SockFile:  global.SockFile,
+		ServiceId:    serviceId,
+		Yaml:         appYaml,
+		BaseDir:      global.BaseDir,
+		SockFile:     global.SockFile,
+		CgroupSlice:  global.GetCgroupSlice(),
+		ReplicaIndex: replicaIndex,
 	}
 	m, _ := json.Marshal(opts)
-	_, err := global.Xengine.Transaction(func(session *xorm.Session) (any, error) {
+	cmdRet, err := reexec.RunAsyncCommand(
+		global.BaseDir,
+		global.AppPath+" service",
+		nil,
+		bytes.NewReader(m),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if cmdRet == nil {
+		return nil, errors.New("run command failed")
+	}
+	return cmdRet, nil
+}
+
+// createService 新建服务 返回serviceId
+func createService(appYaml process.Yaml, replicaIndex int) (string, error) {
+	serviceId := util.RandomUuid()[:16]
+	var cmdRet *reexec.AsyncCommand
+	err := store.Transaction(func(tx servicemd.Store) error {
 		var err2 error
-		cmdRet, err2 = reexec.RunAsyncCommand(
-			global.BaseDir,
-			global.AppPath+" service",
-			nil,
-			bytes.NewReader(m),
-		)
+		cmdRet, err2 = spawnSupervisor(serviceId, replicaIndex, appYaml)
 		if err2 != nil {
-			return nil, err2
-		}
-		if cmdRet == nil {
-			return nil, errors.New("run command failed")
-		}
-		sshHost := global.Viper.GetString("ssh.agent.host")
-		if sshHost == "" {
-			sshHost = fmt.Sprintf("%s:%d", global.LocalIp, global.GetSshAgentPort())
+			return err2
 		}
 		md := &servicemd.Service{
 			Pid:           cmdRet.Cmd.Process.Pid,
@@ -144,16 +344,18 @@ func doApplyAppYaml(appYaml process.Yaml) error {
 			ServiceStatus: string(process.StartingStatus),
 			InstanceId:    global.InstanceId,
 			App:           appYaml.App,
+			Name:          appYaml.Name,
+			ReplicaIndex:  replicaIndex,
 			AppYaml:       &appYaml,
 			Env:           appYaml.Env,
-			AgentHost:     sshHost,
+			AgentHost:     getAgentHost(),
 			AgentToken:    global.SshToken,
 			EventTime:     time.Now().UnixMilli(),
 		}
-		return nil, servicemd.InsertService(session, md)
+		return tx.InsertService(md)
 	})
 	if err != nil && cmdRet != nil {
 		cmdRet.Kill()
 	}
-	return err
+	return serviceId, err
 }
@@ -0,0 +1,80 @@
+package httpagent
+
+import (
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/stack"
+	"log"
+	"strings"
+)
+
+// doStackUp 按依赖顺序应用服务 每个服务就绪后才应用依赖它的服务
+func doStackUp(cfg stack.Cfg) (string, error) {
+	if err := cfg.IsValid(); err != nil {
+		return "", err
+	}
+	ret := make([]string, 0)
+	for _, name := range cfg.Order() {
+		appYaml := cfg.ServiceYaml(name)
+		msg, err := doApplyAppYaml(appYaml, "stack "+cfg.Name)
+		if msg != "" {
+			ret = append(ret, msg)
+		}
+		if err != nil {
+			return strings.Join(ret, "\n"), fmt.Errorf("apply %s failed: %v", name, err)
+		}
+		services, err := store.ListServiceByKey(global.InstanceId, appYaml.App, appYaml.Env, appYaml.Name)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+		for _, srv := range services {
+			if err = waitServiceReady(srv.ServiceId, appYaml); err != nil {
+				return strings.Join(ret, "\n"), fmt.Errorf("%s %s is not ready: %v", name, srv.ServiceId, err)
+			}
+		}
+		log.Printf("stack %s: %s is ready", cfg.Name, name)
+	}
+	return strings.Join(ret, "\n"), nil
+}
+
+// doStackDown 按依赖顺序的反序停止并删除服务
+func doStackDown(cfg stack.Cfg) (string, error) {
+	if err := cfg.IsValid(); err != nil {
+		return "", err
+	}
+	order := cfg.Order()
+	ret := make([]string, 0)
+	for i := len(order) - 1; i >= 0; i-- {
+		appYaml := cfg.ServiceYaml(order[i])
+		removed, err := removeServicesByKey(appYaml.App, appYaml.Env, appYaml.Name, "")
+		ret = append(ret, removed...)
+		if err != nil {
+			return strings.Join(ret, "\n"), err
+		}
+	}
+	return strings.Join(ret, "\n"), nil
+}
+
+func doStackLs(cfg stack.Cfg) ([]global.StackServiceVO, error) {
+	if err := cfg.IsValid(); err != nil {
+		return nil, err
+	}
+	ret := make([]global.StackServiceVO, 0, len(cfg.Services))
+	for _, name := range cfg.Order() {
+		appYaml := cfg.ServiceYaml(name)
+		services, err := store.ListServiceByKey(global.InstanceId, appYaml.App, appYaml.Env, appYaml.Name)
+		if err != nil {
+			return nil, err
+		}
+		vo := global.StackServiceVO{
+			Service:   name,
+			DependsOn: cfg.Services[name].DependsOn,
+			Services:  make([]global.ServiceVO, 0, len(services)),
+		}
+		for _, srv := range services {
+			vo.Services = append(vo.Services, toServiceVO(srv))
+		}
+		ret = append(ret, vo)
+	}
+	return ret, nil
+}
@@ -0,0 +1,19 @@
+package httpagent
+
+import (
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/servicemd"
+	"log"
+)
+
+// store 服务元数据的存储 由InitStore按xorm.driver初始化
+var store servicemd.Store
+
+// InitStore 需在migrate之后 其他Start之前调用
+func InitStore() {
+	var err error
+	store, err = servicemd.NewStore(global.GetXormDriver(), global.Xengine)
+	if err != nil {
+		log.Fatalf("init store failed with err: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	migrateLockName = "zallet_migrate"
+	// migrateLockTimeout 等待其他实例执行完迁移的最长时间
+	migrateLockTimeout = 5 * time.Minute
+)
+
+// acquireLock 多个实例同时启动时串行执行迁移 返回释放函数
+func acquireLock(engine *xorm.Engine) (func(), error) {
+	if engine.Dialect().URI().DBType == schemas.SQLITE {
+		return acquireFileLock(engine)
+	}
+	return acquireMysqlLock(engine)
+}
+
+// acquireMysqlLock GET_LOCK属于连接 需在同一个连接上释放 连接断开时自动释放
+func acquireMysqlLock(engine *xorm.Engine) (func(), error) {
+	ctx := context.Background()
+	conn, err := engine.DB().Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ret sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrateLockName, int(migrateLockTimeout.Seconds())).Scan(&ret)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !ret.Valid || ret.Int64 != 1 {
+		conn.Close()
+		return nil, errors.New("wait for migrate lock timeout")
+	}
+	return func() {
+		var released sql.NullInt64
+		conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", migrateLockName).Scan(&released)
+		conn.Close()
+	}, nil
+}
+
+// acquireFileLock sqlite只对本机可见 对数据库文件旁的锁文件加flock 进程退出时自动释放
+func acquireFileLock(engine *xorm.Engine) (func(), error) {
+	rows, err := engine.QueryString("SELECT file FROM pragma_database_list WHERE name = 'main'")
+	if err != nil {
+		return nil, err
+	}
+	// 内存数据库只对当前连接可见
+	if len(rows) == 0 || rows[0]["file"] == "" {
+		return func() {}, nil
+	}
+	file, err := os.OpenFile(rows[0]["file"]+".migrate.lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,242 @@
+package migrate
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+	"xorm.io/xorm"
+)
+
+// SchemaVersion 已执行的迁移版本
+type SchemaVersion struct {
+	Id          int64     `json:"id" xorm:"pk autoincr"`
+	Version     int       `json:"version" xorm:"unique"`
+	Description string    `json:"description"`
+	Created     time.Time `json:"created" xorm:"created"`
+}
+
+func (*SchemaVersion) TableName() string {
+	return "zallet_schema_version"
+}
+
+// Migration 一个版本的迁移 按表结构快照补齐缺少的表 字段和索引 只增加不删除
+// 新增字段时追加新版本和新快照 已有版本不可修改
+type Migration struct {
+	Version     int
+	Description string
+	Beans       []any
+}
+
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create service tables",
+		Beans: []any{
+			new(serviceV1),
+			new(serviceEventV1),
+			new(serviceRevisionV1),
+			new(serviceRunV1),
+		},
+	},
+	{
+		Version:     2,
+		Description: "create instance table",
+		Beans: []any{
+			new(instanceV2),
+		},
+	},
+	{
+		Version:     3,
+		Description: "add service action",
+		Beans: []any{
+			new(serviceV3),
+		},
+	},
+	{
+		Version:     4,
+		Description: "create lease table",
+		Beans: []any{
+			new(leaseV4),
+		},
+	},
+}
+
+// PendingMigration 待执行的迁移及对应的ddl
+type PendingMigration struct {
+	Version     int
+	Description string
+	Sqls        []string
+	beans       []any
+}
+
+// tableState 数据库中已有的字段和索引
+type tableState struct {
+	columns map[string]bool
+	indexes map[string]bool
+}
+
+func loadSchemaState(engine *xorm.Engine) (map[string]*tableState, error) {
+	tables, err := engine.DBMetas()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*tableState, len(tables))
+	for _, table := range tables {
+		state := &tableState{
+			columns: make(map[string]bool),
+			indexes: make(map[string]bool),
+		}
+		for _, col := range table.Columns() {
+			state.columns[col.Name] = true
+		}
+		for name := range table.Indexes {
+			state.indexes[name] = true
+		}
+		ret[table.Name] = state
+	}
+	return ret, nil
+}
+
+// buildDDL 对比已有结构生成ddl 并更新state 以便后续版本基于执行后的结构生成
+func buildDDL(engine *xorm.Engine, state map[string]*tableState, beans []any) ([]string, error) {
+	dialect := engine.Dialect()
+	ret := make([]string, 0)
+	for _, bean := range beans {
+		table, err := engine.TableInfo(bean)
+		if err != nil {
+			return nil, err
+		}
+		ts, exist := state[table.Name]
+		if !exist {
+			sql, _, err := dialect.CreateTableSQL(context.Background(), engine.DB(), table, table.Name)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, sql)
+			ts = &tableState{
+				columns: make(map[string]bool),
+				indexes: make(map[string]bool),
+			}
+			for _, col := range table.Columns() {
+				ts.columns[col.Name] = true
+			}
+			state[table.Name] = ts
+		}
+		for _, col := range table.Columns() {
+			if !ts.columns[col.Name] {
+				ret = append(ret, dialect.AddColumnSQL(table.Name, col))
+				ts.columns[col.Name] = true
+			}
+		}
+		names := make([]string, 0, len(table.Indexes))
+		for name := range table.Indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !ts.indexes[name] {
+				ret = append(ret, dialect.CreateIndexSQL(table.Name, table.Indexes[name]))
+				ts.indexes[name] = true
+			}
+		}
+	}
+	return ret, nil
+}
+
+// listAppliedVersions 版本表不存在时返回空
+func listAppliedVersions(engine *xorm.Engine, state map[string]*tableState) (map[int]bool, error) {
+	ret := make(map[int]bool)
+	if _, b := state[(&SchemaVersion{}).TableName()]; !b {
+		return ret, nil
+	}
+	versions := make([]SchemaVersion, 0)
+	err := engine.Find(&versions)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		ret[v.Version] = true
+	}
+	return ret, nil
+}
+
+// Pending 返回待执行的迁移 版本0为创建版本表本身
+func Pending(engine *xorm.Engine) ([]PendingMigration, error) {
+	state, err := loadSchemaState(engine)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := listAppliedVersions(engine, state)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]PendingMigration, 0)
+	versionBeans := []any{new(SchemaVersion)}
+	sqls, err := buildDDL(engine, state, versionBeans)
+	if err != nil {
+		return nil, err
+	}
+	if len(sqls) > 0 {
+		ret = append(ret, PendingMigration{
+			Description: "create schema version table",
+			Sqls:        sqls,
+			beans:       versionBeans,
+		})
+	}
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		sqls, err = buildDDL(engine, state, m.Beans)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, PendingMigration{
+			Version:     m.Version,
+			Description: m.Description,
+			Sqls:        sqls,
+			beans:       m.Beans,
+		})
+	}
+	return ret, nil
+}
+
+// Run 持有迁移锁后重新读取已执行的版本 再按版本顺序执行 每个版本执行前重新读取表结构
+func Run(engine *xorm.Engine) error {
+	unlock, err := acquireLock(engine)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	pending, err := Pending(engine)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		state, err := loadSchemaState(engine)
+		if err != nil {
+			return err
+		}
+		sqls, err := buildDDL(engine, state, m.beans)
+		if err != nil {
+			return err
+		}
+		for _, sql := range sqls {
+			if _, err = engine.Exec(sql); err != nil {
+				return err
+			}
+		}
+		if m.Version > 0 {
+			_, err = engine.Insert(&SchemaVersion{
+				Version:     m.Version,
+				Description: m.Description,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("migrate version: %d %s", m.Version, m.Description)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"xorm.io/xorm"
+)
+
+func newTestEngine(t *testing.T, file string) *xorm.Engine {
+	engine, err := xorm.NewEngine("sqlite", "file:"+file+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("new engine failed with err: %v", err)
+	}
+	engine.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		engine.Close()
+	})
+	return engine
+}
+
+func TestMigrationVersions(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migrations[%d].Version = %d, want %d", i, m.Version, i+1)
+		}
+		if len(m.Beans) == 0 {
+			t.Errorf("migration %d has no beans", m.Version)
+		}
+	}
+}
+
+func TestRunIdempotent(t *testing.T) {
+	engine := newTestEngine(t, filepath.Join(t.TempDir(), "zallet.db"))
+	pending, err := Pending(engine)
+	if err != nil {
+		t.Fatalf("Pending failed with err: %v", err)
+	}
+	// 版本表在最前 其余按版本顺序
+	if len(pending) != len(migrations)+1 || pending[0].Version != 0 {
+		t.Fatalf("Pending() returned %d migrations, want version table and %d migrations", len(pending), len(migrations))
+	}
+	for i, m := range pending[1:] {
+		if m.Version != migrations[i].Version {
+			t.Errorf("pending[%d].Version = %d, want %d", i+1, m.Version, migrations[i].Version)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err = Run(engine); err != nil {
+			t.Fatalf("Run #%d failed with err: %v", i+1, err)
+		}
+	}
+	pending, err = Pending(engine)
+	if err != nil {
+		t.Fatalf("Pending failed with err: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Pending() after Run returned %d migrations, want 0", len(pending))
+	}
+	versions := make([]SchemaVersion, 0)
+	if err = engine.Asc("id").Find(&versions); err != nil {
+		t.Fatalf("find versions failed with err: %v", err)
+	}
+	if len(versions) != len(migrations) {
+		t.Fatalf("recorded %d versions, want %d", len(versions), len(migrations))
+	}
+	for i, v := range versions {
+		if v.Version != migrations[i].Version {
+			t.Errorf("versions[%d] = %d, want %d", i, v.Version, migrations[i].Version)
+		}
+	}
+}
+
+// createLegacyTable 手写ddl创建的服务表只有部分字段
+func createLegacyTable(t *testing.T, engine *xorm.Engine) {
+	_, err := engine.Exec("CREATE TABLE zallet_service (id INTEGER PRIMARY KEY AUTOINCREMENT, service_id TEXT, app TEXT, env TEXT, event_time INTEGER)")
+	if err != nil {
+		t.Fatalf("create legacy table failed with err: %v", err)
+	}
+	_, err = engine.Exec("INSERT INTO zallet_service (service_id, app, env, event_time) VALUES ('s1', 'a', 'dev', 1)")
+	if err != nil {
+		t.Fatalf("insert legacy row failed with err: %v", err)
+	}
+}
+
+func TestPendingLegacyTable(t *testing.T) {
+	engine := newTestEngine(t, filepath.Join(t.TempDir(), "zallet.db"))
+	createLegacyTable(t, engine)
+	pending, err := Pending(engine)
+	if err != nil {
+		t.Fatalf("Pending failed with err: %v", err)
+	}
+	var v1 PendingMigration
+	for _, m := range pending {
+		if m.Version == 1 {
+			v1 = m
+		}
+	}
+	sqls := strings.Join(v1.Sqls, "\n")
+	for _, want := range []string{"ADD `name`", "ADD `replica_index`", "CREATE TABLE IF NOT EXISTS `zallet_service_event`"} {
+		if !strings.Contains(sqls, want) {
+			t.Errorf("version 1 sqls should contain %q, got:\n%s", want, sqls)
+		}
+	}
+	if strings.Contains(sqls, "CREATE TABLE IF NOT EXISTS `zallet_service` ") {
+		t.Errorf("version 1 sqls should not create the existing service table, got:\n%s", sqls)
+	}
+	if err = Run(engine); err != nil {
+		t.Fatalf("Run failed with err: %v", err)
+	}
+	// 新增字段带默认值 已有数据行可以按空值查询
+	count, err := engine.Table("zallet_service").Where("name = ?", "").And("replica_index = ?", 0).Count()
+	if err != nil {
+		t.Fatalf("count legacy rows failed with err: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("legacy rows with default values = %d, want 1", count)
+	}
+}
+
+func TestRunConcurrent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "zallet.db")
+	engines := []*xorm.Engine{newTestEngine(t, file), newTestEngine(t, file), newTestEngine(t, file)}
+	// 已有服务表时每个实例都会生成相同的ALTER TABLE
+	createLegacyTable(t, engines[0])
+	var wg sync.WaitGroup
+	errs := make([]error, len(engines))
+	for i := range engines {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = Run(engines[i])
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Run #%d failed with err: %v", i, err)
+		}
+	}
+	count, err := engines[0].Count(new(SchemaVersion))
+	if err != nil {
+		t.Fatalf("count versions failed with err: %v", err)
+	}
+	if int(count) != len(migrations) {
+		t.Errorf("recorded %d versions, want %d", count, len(migrations))
+	}
+}
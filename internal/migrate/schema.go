@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"time"
+)
+
+// 各版本迁移时的表结构快照 与servicemd中的结构体分开定义
+// 结构体后续变化不影响已发布版本生成的ddl 新增字段需追加新版本和新快照
+// 新增字段均为not null并带默认值 保证已有数据行可以被按值查询
+
+// serviceV1 服务表 在原有字段的基础上新增副本 来源和退出信息
+type serviceV1 struct {
+	Id            int64     `xorm:"pk autoincr"`
+	ServiceId     string    `xorm:"notnull default ''"`
+	Pid           int       `xorm:"notnull default 0"`
+	InstanceId    string    `xorm:"notnull default ''"`
+	App           string    `xorm:"notnull default ''"`
+	Name          string    `xorm:"notnull default ''"`
+	ReplicaIndex  int       `xorm:"notnull default 0"`
+	Source        string    `xorm:"notnull default ''"`
+	AppYaml       string    `xorm:"text"`
+	ServiceStatus string    `xorm:"notnull default ''"`
+	ErrLog        string    `xorm:"notnull default ''"`
+	AgentHost     string    `xorm:"notnull default ''"`
+	AgentToken    string    `xorm:"notnull default ''"`
+	Env           string    `xorm:"notnull default ''"`
+	CpuPercent    int       `xorm:"notnull default 0"`
+	MemPercent    int       `xorm:"notnull default 0"`
+	StopReason    string    `xorm:"notnull default ''"`
+	StopDuration  int64     `xorm:"notnull default 0"`
+	ExitCode      int       `xorm:"notnull default 0"`
+	ExitSignal    string    `xorm:"notnull default ''"`
+	CoreDumped    bool      `xorm:"notnull default 0"`
+	Runtime       int64     `xorm:"notnull default 0"`
+	OutputTail    string    `xorm:"text"`
+	RestartCount  int       `xorm:"notnull default 0"`
+	EventTime     int64     `xorm:"notnull default 0"`
+	EventSeq      int64     `xorm:"notnull default 0"`
+	Created       time.Time `xorm:"created"`
+}
+
+func (*serviceV1) TableName() string {
+	return "zallet_service"
+}
+
+type serviceEventV1 struct {
+	Id         int64     `xorm:"pk autoincr"`
+	ServiceId  string    `xorm:"notnull default ''"`
+	InstanceId string    `xorm:"notnull default ''"`
+	App        string    `xorm:"notnull default ''"`
+	Env        string    `xorm:"notnull default ''"`
+	Status     string    `xorm:"notnull default ''"`
+	ErrLog     string    `xorm:"text"`
+	CpuPercent int       `xorm:"notnull default 0"`
+	MemPercent int       `xorm:"notnull default 0"`
+	Pid        int       `xorm:"notnull default 0"`
+	ProcessPid int       `xorm:"notnull default 0"`
+	StopReason string    `xorm:"notnull default ''"`
+	ExitCode   int       `xorm:"notnull default 0"`
+	ExitSignal string    `xorm:"notnull default ''"`
+	EventTime  int64     `xorm:"notnull default 0"`
+	Created    time.Time `xorm:"created"`
+}
+
+func (*serviceEventV1) TableName() string {
+	return "zallet_service_event"
+}
+
+// serviceRevisionV1 同一服务key下版本号唯一
+type serviceRevisionV1 struct {
+	Id         int64     `xorm:"pk autoincr"`
+	App        string    `xorm:"unique(app_env_name_revision) notnull default ''"`
+	Env        string    `xorm:"unique(app_env_name_revision) notnull default ''"`
+	Name       string    `xorm:"unique(app_env_name_revision) notnull default ''"`
+	Revision   int       `xorm:"unique(app_env_name_revision) notnull default 0"`
+	AppYaml    string    `xorm:"text"`
+	Note       string    `xorm:"notnull default ''"`
+	InstanceId string    `xorm:"notnull default ''"`
+	Created    time.Time `xorm:"created"`
+}
+
+func (*serviceRevisionV1) TableName() string {
+	return "zallet_service_revision"
+}
+
+type serviceRunV1 struct {
+	Id         int64     `xorm:"pk autoincr"`
+	ServiceId  string    `xorm:"notnull default ''"`
+	InstanceId string    `xorm:"notnull default ''"`
+	App        string    `xorm:"notnull default ''"`
+	Env        string    `xorm:"notnull default ''"`
+	StartTime  int64     `xorm:"notnull default 0"`
+	Duration   int64     `xorm:"notnull default 0"`
+	Status     string    `xorm:"notnull default ''"`
+	StopReason string    `xorm:"notnull default ''"`
+	ExitCode   int       `xorm:"notnull default 0"`
+	ExitSignal string    `xorm:"notnull default ''"`
+	ErrLog     string    `xorm:"text"`
+	Created    time.Time `xorm:"created"`
+}
+
+func (*serviceRunV1) TableName() string {
+	return "zallet_service_run"
+}
+
+type instanceV2 struct {
+	Id          int64     `xorm:"pk autoincr"`
+	InstanceId  string    `xorm:"unique notnull default ''"`
+	LocalIp     string    `xorm:"notnull default ''"`
+	AgentHost   string    `xorm:"notnull default ''"`
+	Version     string    `xorm:"notnull default ''"`
+	StartTime   int64     `xorm:"notnull default 0"`
+	CpuPercent  int       `xorm:"notnull default 0"`
+	MemPercent  int       `xorm:"notnull default 0"`
+	DiskPercent int       `xorm:"notnull default 0"`
+	Labels      string    `xorm:"text"`
+	Heartbeat   int64     `xorm:"notnull default 0"`
+	Created     time.Time `xorm:"created"`
+}
+
+func (*instanceV2) TableName() string {
+	return "zallet_instance"
+}
+
+// serviceV3 服务表新增待执行的操作
+type serviceV3 struct {
+	Action string `xorm:"notnull default ''"`
+}
+
+func (*serviceV3) TableName() string {
+	return "zallet_service"
+}
+
+type leaseV4 struct {
+	Id          int64     `xorm:"pk autoincr"`
+	Name        string    `xorm:"unique notnull default ''"`
+	Holder      string    `xorm:"notnull default ''"`
+	AcquireTime int64     `xorm:"notnull default 0"`
+	ExpireTime  int64     `xorm:"notnull default 0"`
+	Created     time.Time `xorm:"created"`
+}
+
+func (*leaseV4) TableName() string {
+	return "zallet_lease"
+}
@@ -0,0 +1,462 @@
+package process
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type ArtifactFormat string
+
+const (
+	TarGzArtifactFormat ArtifactFormat = "tar.gz"
+	ZipArtifactFormat   ArtifactFormat = "zip"
+	// RawArtifactFormat 单个可执行文件 不解压
+	RawArtifactFormat ArtifactFormat = "raw"
+)
+
+const (
+	defaultKeepReleases     = 3
+	artifactDownloadTimeout = 30 * time.Minute
+	releasesDirName         = "releases"
+	currentLinkName         = "current"
+	// stagedLinkName 下载期间指向将要切换的版本 防止切换前被其他服务清理
+	stagedLinkName = "staged"
+	// releaseHistoryName 服务最近使用的版本 每行一个 最新的在前
+	releaseHistoryName = "releases.history"
+)
+
+var (
+	sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// ArtifactCfg 启动前下载并解压到workdir/releases下 再切换服务数据目录下的current
+type ArtifactCfg struct {
+	// Url http(s)地址或本地路径
+	Url    string         `json:"url" yaml:"url"`
+	Sha256 string         `json:"sha256" yaml:"sha256"`
+	Format ArtifactFormat `json:"format" yaml:"format"`
+	// Keep 每个服务保留最近使用的版本数 包括当前版本 默认3个
+	Keep int `json:"keep,omitempty" yaml:"keep,omitempty"`
+}
+
+func (c *ArtifactCfg) IsValid() error {
+	if c.Url == "" {
+		return errors.New("invalid artifact url")
+	}
+	if !sha256Pattern.MatchString(c.Sha256) {
+		return errors.New("invalid artifact sha256")
+	}
+	switch c.Format {
+	case TarGzArtifactFormat, ZipArtifactFormat, RawArtifactFormat:
+	default:
+		return fmt.Errorf("invalid artifact format: %s", c.Format)
+	}
+	if c.Keep < 0 {
+		return errors.New("invalid artifact keep")
+	}
+	return nil
+}
+
+func (c *ArtifactCfg) getKeep() int {
+	if c.Keep <= 0 {
+		return defaultKeepReleases
+	}
+	return c.Keep
+}
+
+// releaseName 按checksum区分版本 回滚到已有版本时无需重新下载
+func (c *ArtifactCfg) releaseName() string {
+	return c.Sha256[:12]
+}
+
+// runDir 进程的工作目录 有artifact时为服务数据目录下的current 同一workdir的多个服务互不影响
+func (s *Supervisor) runDir(y *Yaml) string {
+	if y.Artifact != nil {
+		return filepath.Join(ServiceDir(s.opts.BaseDir, s.opts.ServiceId), currentLinkName)
+	}
+	return y.Workdir
+}
+
+// getReleaseDir 配置的版本解压后的绝对路径
+func getReleaseDir(y *Yaml) (string, error) {
+	releasesDir, err := filepath.Abs(filepath.Join(y.Workdir, releasesDirName))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(releasesDir, y.Artifact.releaseName()), nil
+}
+
+// serviceFile 服务数据目录下的文件
+func (s *Supervisor) serviceFile(name string) string {
+	return filepath.Join(ServiceDir(s.opts.BaseDir, s.opts.ServiceId), name)
+}
+
+// stageRelease 下载前先通过staged占用目标版本 释放锁下载期间其他服务清理版本时会保留
+func (s *Supervisor) stageRelease(y *Yaml) error {
+	releaseDir, err := getReleaseDir(y)
+	if err != nil {
+		return err
+	}
+	return switchLink(s.serviceFile(stagedLinkName), releaseDir)
+}
+
+func (s *Supervisor) unstageRelease() {
+	os.Remove(s.serviceFile(stagedLinkName))
+}
+
+// fetchArtifact 下载校验并解压artifact到workdir/releases 已存在的版本无需下载
+// 不修改current 可在不持有锁时执行 多个服务同时下载时各自使用独立的临时文件
+func fetchArtifact(workdir string, cfg *ArtifactCfg) error {
+	releasesDir := filepath.Join(workdir, releasesDirName)
+	err := os.MkdirAll(releasesDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	name := cfg.releaseName()
+	releaseDir := filepath.Join(releasesDir, name)
+	exist, err := util.IsExist(releaseDir)
+	if err != nil || exist {
+		return err
+	}
+	if err = fetchRelease(releasesDir, name, cfg); err != nil {
+		return err
+	}
+	log.Printf("artifact: %s unpacked to %s", cfg.Url, releaseDir)
+	return nil
+}
+
+// activateRelease 切换服务的current到已下载的版本 记录到服务的版本历史 并清理所有服务都不再保留的版本
+func (s *Supervisor) activateRelease(y *Yaml) error {
+	releaseDir, err := getReleaseDir(y)
+	if err != nil {
+		return err
+	}
+	err = switchLink(s.runDir(y), releaseDir)
+	if err != nil {
+		return err
+	}
+	s.unstageRelease()
+	if err = recordRelease(s.serviceFile(releaseHistoryName), releaseDir, y.Artifact.getKeep()); err != nil {
+		log.Printf("%s record release failed with err: %v", s.opts.ServiceId, err)
+	}
+	releasesDir := filepath.Dir(releaseDir)
+	pruneReleases(releasesDir, keptReleases(s.opts.BaseDir, releasesDir))
+	return nil
+}
+
+// fetchRelease 下载到临时文件并校验 解压到临时目录后再重命名 避免留下不完整的版本
+func fetchRelease(releasesDir, name string, cfg *ArtifactCfg) error {
+	tmp, err := os.CreateTemp(releasesDir, "."+name+"-*.download")
+	if err != nil {
+		return err
+	}
+	tmpFile := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpFile)
+	tmpDir, err := os.MkdirTemp(releasesDir, "."+name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer util.RemoveAll(tmpDir)
+	err = downloadArtifact(cfg.Url, tmpFile, cfg.Sha256)
+	if err != nil {
+		return err
+	}
+	switch cfg.Format {
+	case TarGzArtifactFormat:
+		err = untarGz(tmpFile, tmpDir)
+	case ZipArtifactFormat:
+		err = unzip(tmpFile, tmpDir)
+	default:
+		err = copyRaw(tmpFile, filepath.Join(tmpDir, path.Base(cfg.Url)))
+	}
+	if err != nil {
+		return fmt.Errorf("unpack artifact failed: %v", err)
+	}
+	releaseDir := filepath.Join(releasesDir, name)
+	if err = os.Rename(tmpDir, releaseDir); err != nil {
+		// 其他服务已解压了相同的版本
+		if exist, _ := util.IsExist(releaseDir); exist {
+			return nil
+		}
+	}
+	return err
+}
+
+func downloadArtifact(url, dst, checksum string) error {
+	var src io.ReadCloser
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		client := &http.Client{
+			Timeout: artifactDownloadTimeout,
+		}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("download artifact: %s statusCode: %v", url, resp.StatusCode)
+		}
+		src = resp.Body
+	} else {
+		file, err := os.Open(url)
+		if err != nil {
+			return err
+		}
+		src = file
+	}
+	defer src.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(out, hash), src); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != checksum {
+		return fmt.Errorf("artifact sha256 mismatch: expected %s actual %s", checksum, actual)
+	}
+	return nil
+}
+
+// safeJoin 防止压缩包内的路径跳出解压目录 路径中已有的软链接不能被穿过
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	if !isWithin(dir, target) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+	rel, _ := filepath.Rel(dir, target)
+	p := dir
+	for _, elem := range strings.Split(rel, string(os.PathSeparator)) {
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("illegal file path through symlink: %s", name)
+		}
+	}
+	return target, nil
+}
+
+func isWithin(dir, target string) bool {
+	return target == dir || strings.HasPrefix(target, dir+string(os.PathSeparator))
+}
+
+// writeSymlink 软链接只能指向解压目录内
+func writeSymlink(dir, target, linkname string) error {
+	if filepath.IsAbs(linkname) || !isWithin(dir, filepath.Join(filepath.Dir(target), linkname)) {
+		return fmt.Errorf("illegal symlink: %s -> %s", target, linkname)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Symlink(linkname, target)
+}
+
+func untarGz(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := safeJoin(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, os.FileMode(header.Mode).Perm()|0700)
+		case tar.TypeReg:
+			err = writeFile(target, tr, os.FileMode(header.Mode).Perm())
+		case tar.TypeSymlink:
+			err = writeSymlink(dir, target, header.Linkname)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func unzip(file, dir string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		target, err := safeJoin(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		if zf.FileInfo().IsDir() {
+			if err = os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		if zf.Mode()&os.ModeSymlink != 0 {
+			// 软链接的内容为链接目标
+			var linkname []byte
+			linkname, err = io.ReadAll(io.LimitReader(rc, 4096))
+			if err == nil {
+				err = writeSymlink(dir, target, string(linkname))
+			}
+		} else {
+			err = writeFile(target, rc, zf.Mode().Perm())
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyRaw(file, target string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeFile(target, f, 0755)
+}
+
+func writeFile(target string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// switchLink 通过重命名原子替换软链接
+func switchLink(link, target string) error {
+	if old, err := os.Readlink(link); err == nil && old == target {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(link), os.ModePerm); err != nil {
+		return err
+	}
+	tmpLink := filepath.Join(filepath.Dir(link), "."+filepath.Base(link)+".tmp")
+	os.Remove(tmpLink)
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpLink, link); err != nil {
+		os.Remove(tmpLink)
+		return err
+	}
+	log.Printf("switch %s to %s", link, target)
+	return nil
+}
+
+// recordRelease 把版本放到历史的最前面 只保留最近keep个
+func recordRelease(file, releaseDir string, keep int) error {
+	history := []string{releaseDir}
+	content, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if len(history) >= keep {
+			break
+		}
+		if line != "" && line != releaseDir {
+			history = append(history, line)
+		}
+	}
+	tmpFile := file + ".tmp"
+	if err = os.WriteFile(tmpFile, []byte(strings.Join(history, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// keptReleases 本机各服务的current staged和版本历史中属于releasesDir的版本
+func keptReleases(baseDir, releasesDir string) map[string]bool {
+	ret := make(map[string]bool)
+	keep := func(target string) {
+		if filepath.Dir(target) == releasesDir {
+			ret[filepath.Base(target)] = true
+		}
+	}
+	dirs, _ := filepath.Glob(ServiceDir(baseDir, "*"))
+	for _, dir := range dirs {
+		for _, name := range []string{currentLinkName, stagedLinkName} {
+			if target, err := os.Readlink(filepath.Join(dir, name)); err == nil {
+				keep(target)
+			}
+		}
+		content, err := os.ReadFile(filepath.Join(dir, releaseHistoryName))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			keep(line)
+		}
+	}
+	return ret
+}
+
+// pruneReleases 删除没有任何服务保留的版本 跳过正在下载和解压的临时文件
+func pruneReleases(releasesDir string, kept map[string]bool) {
+	entries, err := os.ReadDir(releasesDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || kept[entry.Name()] {
+			continue
+		}
+		if err = util.RemoveAll(filepath.Join(releasesDir, entry.Name())); err != nil {
+			log.Printf("remove release: %s failed with err: %v", entry.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRecordRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []string
+		release  string
+		keep     int
+		expected []string
+	}{
+		{"first release", nil, "/r/a", 3, []string{"/r/a"}},
+		{"newest first", []string{"/r/a"}, "/r/b", 3, []string{"/r/b", "/r/a"}},
+		{"trim to keep", []string{"/r/c", "/r/b", "/r/a"}, "/r/d", 3, []string{"/r/d", "/r/c", "/r/b"}},
+		{"move existing to front", []string{"/r/c", "/r/b", "/r/a"}, "/r/a", 3, []string{"/r/a", "/r/c", "/r/b"}},
+		{"keep one", []string{"/r/b", "/r/a"}, "/r/c", 1, []string{"/r/c"}},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), releaseHistoryName)
+		if tt.history != nil {
+			if err := os.WriteFile(file, []byte(strings.Join(tt.history, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := recordRelease(file, tt.release, tt.keep); err != nil {
+			t.Errorf("%s: recordRelease failed with err: %v", tt.name, err)
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Fields(string(content)); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: history = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestPruneReleases(t *testing.T) {
+	type service struct {
+		current string
+		staged  string
+		history []string
+	}
+	tests := []struct {
+		name     string
+		releases []string
+		services map[string]service
+		expected []string
+	}{
+		{
+			name:     "keep current and history of each service",
+			releases: []string{"r1", "r2", "r3", "r4", "r5"},
+			services: map[string]service{
+				"s1": {current: "r3", history: []string{"r3", "r2"}},
+				"s2": {current: "r1", history: []string{"r1"}},
+			},
+			expected: []string{"r1", "r2", "r3"},
+		},
+		{
+			name:     "staged release is kept before switching",
+			releases: []string{"r1", "r2"},
+			services: map[string]service{
+				"s1": {current: "r1", history: []string{"r1"}},
+				"s2": {staged: "r2"},
+			},
+			expected: []string{"r1", "r2"},
+		},
+		{
+			name:     "other services do not reduce own keep",
+			releases: []string{"r1", "r2", "r3", "r4"},
+			services: map[string]service{
+				"s1": {current: "r4", history: []string{"r4", "r3", "r2"}},
+				"s2": {current: "r1", history: []string{"r1"}},
+				"s3": {current: "r1", history: []string{"r1"}},
+			},
+			expected: []string{"r1", "r2", "r3", "r4"},
+		},
+		{
+			name:     "temporary files are skipped",
+			releases: []string{"r1", ".r2-1.tmp"},
+			services: map[string]service{},
+			expected: []string{".r2-1.tmp"},
+		},
+	}
+	for _, tt := range tests {
+		baseDir := t.TempDir()
+		releasesDir := filepath.Join(t.TempDir(), releasesDirName)
+		for _, r := range tt.releases {
+			if err := os.MkdirAll(filepath.Join(releasesDir, r), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// 其他workdir的版本不影响
+		otherDir := filepath.Join(t.TempDir(), releasesDirName)
+		for id, srv := range tt.services {
+			dir := ServiceDir(baseDir, id)
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if srv.current != "" {
+				os.Symlink(filepath.Join(releasesDir, srv.current), filepath.Join(dir, currentLinkName))
+			}
+			if srv.staged != "" {
+				os.Symlink(filepath.Join(releasesDir, srv.staged), filepath.Join(dir, stagedLinkName))
+			}
+			for _, r := range srv.history {
+				if err := recordRelease(filepath.Join(dir, releaseHistoryName), filepath.Join(releasesDir, r), 1000); err != nil {
+					t.Fatal(err)
+				}
+			}
+			recordRelease(filepath.Join(dir, releaseHistoryName), filepath.Join(otherDir, "r9"), 1000)
+		}
+		pruneReleases(releasesDir, keptReleases(baseDir, releasesDir))
+		entries, err := os.ReadDir(releasesDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			got = append(got, entry.Name())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: remaining releases = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/spf13/cast"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const cgroupMountPoint = "/sys/fs/cgroup"
+
+// cgroup 单个服务的cgroup v2
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+func newCgroup(slice, name string, cfg *ResourcesCfg) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMountPoint, "cgroup.controllers")); err != nil {
+		return nil, errors.New("cgroup v2 is not available")
+	}
+	if slice == "" {
+		slice = defaultCgroupSlice
+	}
+	slicePath := filepath.Join(cgroupMountPoint, slice)
+	if err := os.MkdirAll(slicePath, 0o755); err != nil {
+		return nil, err
+	}
+	ret := &cgroup{
+		path: filepath.Join(slicePath, name),
+	}
+	if err := os.Mkdir(ret.path, 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	if err := ret.update(cfg); err != nil {
+		ret.remove()
+		return nil, err
+	}
+	dir, err := os.Open(ret.path)
+	if err != nil {
+		ret.remove()
+		return nil, err
+	}
+	ret.dir = dir
+	return ret, nil
+}
+
+// update 写入资源限制
+func (c *cgroup) update(cfg *ResourcesCfg) error {
+	controllers := cfg.controllers()
+	// 逐级开启控制器
+	for _, dir := range []string{cgroupMountPoint, filepath.Dir(c.path)} {
+		if err := enableControllers(dir, controllers); err != nil {
+			return err
+		}
+	}
+	files := cfg.controlFiles()
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(c.path, file), []byte(content), 0o644); err != nil {
+			return fmt.Errorf("write %s failed with err: %v", file, err)
+		}
+	}
+	// 未配置的限制恢复默认值 重新加载配置时生效
+	for file, content := range map[string]string{
+		"cpu.max":     "max",
+		"memory.max":  "max",
+		"memory.high": "max",
+		"pids.max":    "max",
+	} {
+		if _, b := files[file]; !b {
+			os.WriteFile(filepath.Join(c.path, file), []byte(content), 0o644)
+		}
+	}
+	return nil
+}
+
+func enableControllers(dir string, controllers []string) error {
+	content, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return err
+	}
+	enabled := strings.Fields(string(content))
+	for _, controller := range controllers {
+		if util.FindInSlice(enabled, controller) {
+			continue
+		}
+		err = os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0o644)
+		if err != nil {
+			return fmt.Errorf("enable cgroup controller %s in %s failed with err: %v", controller, dir, err)
+		}
+	}
+	return nil
+}
+
+// attach 进程启动时直接放入cgroup 避免启动后再迁移产生的子进程逃逸
+func (c *cgroup) attach(cmd *exec.Cmd) (func(int) error, error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+	return nil, nil
+}
+
+func (c *cgroup) memoryEvents() map[string]int64 {
+	ret := make(map[string]int64)
+	content, err := os.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return ret
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			ret[fields[0]] = cast.ToInt64(fields[1])
+		}
+	}
+	return ret
+}
+
+func (c *cgroup) remove() error {
+	if c.dir != nil {
+		c.dir.Close()
+	}
+	// 杀死残留进程 cgroup.kill需要5.14以上内核
+	os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0o644)
+	var err error
+	for i := 0; i < 5; i++ {
+		err = syscall.Rmdir(c.path)
+		if err == nil || err == syscall.ENOENT {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+)
+
+type cgroup struct{}
+
+func newCgroup(string, string, *ResourcesCfg) (*cgroup, error) {
+	return nil, errors.New("cgroup v2 is only supported on linux")
+}
+
+func (c *cgroup) attach(*exec.Cmd) (func(int) error, error) {
+	return nil, errors.New("cgroup v2 is only supported on linux")
+}
+
+func (c *cgroup) update(*ResourcesCfg) error {
+	return errors.New("cgroup v2 is only supported on linux")
+}
+
+func (c *cgroup) memoryEvents() map[string]int64 {
+	return map[string]int64{}
+}
+
+func (c *cgroup) remove() error {
+	return nil
+}
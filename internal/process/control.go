@@ -0,0 +1,214 @@
+package process
+
+import (
+	"errors"
+	"github.com/LeeZXin/zallet/internal/util"
+	"github.com/gin-gonic/gin"
+	gprocess "github.com/shirou/gopsutil/v3/process"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ControlSockFile supervisor控制通道的sock文件
+func ControlSockFile(baseDir, serviceId string) string {
+	return filepath.Join(ServiceDir(baseDir, serviceId), "control.sock")
+}
+
+type Stats struct {
+	ServiceId        string       `json:"serviceId"`
+	Pid              int          `json:"pid"`
+	ProcessPid       int          `json:"processPid"`
+	Status           string       `json:"status"`
+	CpuPercent       int          `json:"cpuPercent"`
+	MemPercent       int          `json:"memPercent"`
+	Retries          int          `json:"retries"`
+	StartTime        int64        `json:"startTime"`
+	ProcessStartTime int64        `json:"processStartTime"`
+	PendingReports   int          `json:"pendingReports"`
+	Probes           []ProbeState `json:"probes"`
+}
+
+type ProbeState struct {
+	Name                 string `json:"name"`
+	Type                 string `json:"type"`
+	LastResult           bool   `json:"lastResult"`
+	LastProbeTime        int64  `json:"lastProbeTime"`
+	ConsecutiveFailures  int    `json:"consecutiveFailures"`
+	ConsecutiveSuccesses int    `json:"consecutiveSuccesses"`
+}
+
+func (s *Supervisor) startControlServer() error {
+	sockFile := ControlSockFile(s.opts.BaseDir, s.opts.ServiceId)
+	err := os.Remove(sockFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", sockFile)
+	if err != nil {
+		return err
+	}
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	engine.ContextWithFallback = true
+	group := engine.Group("/api/v1")
+	{
+		// 重启进程
+		group.PUT("/restart", func(c *gin.Context) {
+			s.resetRetries()
+			handleControlErr(c, s.RestartProcess())
+		})
+		// 杀死进程 supervisor继续运行
+		group.PUT("/kill", func(c *gin.Context) {
+			handleControlErr(c, s.KillProcess())
+		})
+		// 执行一次定时任务
+		group.PUT("/run", func(c *gin.Context) {
+			handleControlErr(c, s.TriggerRun())
+		})
+		// 重新加载配置
+		group.PUT("/reload", func(c *gin.Context) {
+			var req Yaml
+			if util.ShouldBindJSON(&req, c) {
+				handleControlErr(c, s.Reload(req))
+			}
+		})
+		// 进程状态
+		group.GET("/stats", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.Stats())
+		})
+		// 探针状态
+		group.GET("/probes", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.ProbeStates())
+		})
+	}
+	s.controlSrv = &http.Server{
+		Handler: engine.Handler(),
+	}
+	go func() {
+		err2 := s.controlSrv.Serve(listener)
+		if err2 != nil && err2 != http.ErrServerClosed {
+			log.Printf("%s control server failed with err: %v", s.opts.ServiceId, err2)
+		}
+	}()
+	return nil
+}
+
+func (s *Supervisor) stopControlServer() {
+	if s.controlSrv != nil {
+		s.controlSrv.Close()
+		os.Remove(ControlSockFile(s.opts.BaseDir, s.opts.ServiceId))
+	}
+}
+
+func handleControlErr(c *gin.Context, err error) {
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.String(http.StatusOK, "ok")
+}
+
+func (s *Supervisor) resetRetries() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.retries = 0
+}
+
+// Reload 替换配置并重启进程
+func (s *Supervisor) Reload(y Yaml) error {
+	if err := y.IsValid(); err != nil {
+		return err
+	}
+	s.opLocker.Lock()
+	defer s.opLocker.Unlock()
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if !s.isRunning {
+		return errors.New("supervisor closed")
+	}
+	s.killProcess()
+	if y.Resources != nil {
+		if s.cgroup == nil {
+			cg, err := newCgroup(s.opts.CgroupSlice, s.opts.ServiceId, y.Resources)
+			if err != nil {
+				return err
+			}
+			s.cgroup = cg
+		} else if err := s.cgroup.update(y.Resources); err != nil {
+			return err
+		}
+	} else if s.cgroup != nil {
+		s.cgroup.remove()
+		s.cgroup = nil
+	}
+	s.opts.Yaml = y
+	s.retries = 0
+	s.probeLocker.Lock()
+	s.probeStates = make(map[string]ProbeState)
+	s.probeLocker.Unlock()
+	log.Printf("%s reload config", s.opts.ServiceId)
+	return s.startProcessLocked()
+}
+
+func (s *Supervisor) Stats() Stats {
+	s.locker.Lock()
+	ret := Stats{
+		ServiceId:  s.opts.ServiceId,
+		Pid:        s.pid,
+		ProcessPid: s.process.GetPid(),
+		Status:     string(s.status),
+		Retries:    s.retries,
+		StartTime:  s.startTime.UnixMilli(),
+	}
+	if s.processRunning {
+		ret.ProcessStartTime = s.procStartTime.UnixMilli()
+	}
+	s.locker.Unlock()
+	if ret.ProcessPid > 0 {
+		pcs, err := gprocess.NewProcess(int32(ret.ProcessPid))
+		if err == nil {
+			cpuPercent, err := pcs.CPUPercent()
+			if err == nil {
+				ret.CpuPercent = int(cpuPercent)
+			}
+			memPercent, err := pcs.MemoryPercent()
+			if err == nil {
+				ret.MemPercent = int(memPercent)
+			}
+		}
+	}
+	s.reportLocker.Lock()
+	ret.PendingReports = len(s.pendingReports)
+	s.reportLocker.Unlock()
+	ret.Probes = s.ProbeStates()
+	return ret
+}
+
+func (s *Supervisor) ProbeStates() []ProbeState {
+	s.probeLocker.Lock()
+	defer s.probeLocker.Unlock()
+	ret := make([]ProbeState, 0, len(s.probeStates))
+	for _, name := range []string{"readiness", "liveness"} {
+		if state, b := s.probeStates[name]; b {
+			ret = append(ret, state)
+		}
+	}
+	return ret
+}
+
+func (s *Supervisor) recordProbe(name string, probe *Probe, result bool, failed, succeeded int) {
+	s.probeLocker.Lock()
+	defer s.probeLocker.Unlock()
+	s.probeStates[name] = ProbeState{
+		Name:                 name,
+		Type:                 string(probe.Type),
+		LastResult:           result,
+		LastProbeTime:        time.Now().UnixMilli(),
+		ConsecutiveFailures:  failed,
+		ConsecutiveSuccesses: succeeded,
+	}
+}
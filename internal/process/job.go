@@ -0,0 +1,188 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"io"
+	"log"
+	"time"
+)
+
+type ServiceType string
+
+const (
+	// ServiceServiceType 常驻服务 默认类型
+	ServiceServiceType ServiceType = "service"
+	// JobServiceType 一次性任务 以退出码0结束时为succeeded
+	JobServiceType ServiceType = "job"
+	// CronServiceType 定时任务 由zallet按schedule触发执行
+	CronServiceType ServiceType = "cron"
+)
+
+type ConcurrencyPolicy string
+
+const (
+	// ForbidConcurrencyPolicy 上次执行未结束时跳过本次执行
+	ForbidConcurrencyPolicy ConcurrencyPolicy = "forbid"
+	// AllowConcurrencyPolicy 允许多次执行同时进行
+	AllowConcurrencyPolicy ConcurrencyPolicy = "allow"
+)
+
+var (
+	ErrRunOverlap   = errors.New("previous run is still running")
+	ErrRunSuspended = errors.New("cron service is killed")
+)
+
+func (f *Yaml) isTypeValid() error {
+	switch f.Type {
+	case "", ServiceServiceType, JobServiceType:
+		if f.Schedule != "" {
+			return errors.New("schedule is only for cron")
+		}
+	case CronServiceType:
+		if _, err := util.ParseCron(f.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid type: %s", f.Type)
+	}
+	switch f.Concurrency {
+	case "", ForbidConcurrencyPolicy, AllowConcurrencyPolicy:
+	default:
+		return fmt.Errorf("invalid concurrency: %s", f.Concurrency)
+	}
+	return nil
+}
+
+// GetType 服务类型 默认service
+func (f *Yaml) GetType() ServiceType {
+	if f.Type == "" {
+		return ServiceServiceType
+	}
+	return f.Type
+}
+
+// IsRunOnce job和cron每次执行都会结束 需要记录执行记录
+func (f *Yaml) IsRunOnce() bool {
+	t := f.GetType()
+	return t == JobServiceType || t == CronServiceType
+}
+
+// cronRun 定时任务的一次执行
+type cronRun struct {
+	id        int64
+	proc      *Process
+	startTime time.Time
+	tail      *tailBuffer
+}
+
+// TriggerRun 执行一次定时任务 未设置concurrency: allow时不允许重叠执行
+func (s *Supervisor) TriggerRun() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if !s.isRunning {
+		return errors.New("supervisor closed")
+	}
+	if s.opts.Yaml.GetType() != CronServiceType {
+		return errors.New("not a cron service")
+	}
+	if s.suspended {
+		return ErrRunSuspended
+	}
+	if len(s.runs) > 0 && s.opts.Yaml.Concurrency != AllowConcurrencyPolicy {
+		return ErrRunOverlap
+	}
+	return s.startRunLocked()
+}
+
+// startRunLocked 启动一次执行 调用方需持有锁
+func (s *Supervisor) startRunLocked() error {
+	tail := newTailBuffer(s.opts.Yaml.Log.getTailSize())
+	stdout := newLineWriter("stdout", io.MultiWriter(s.logger, tail))
+	stderr := newLineWriter("stderr", io.MultiWriter(s.logger, tail))
+	cmdOpts, err := s.opts.Yaml.sysAttrOptions()
+	if err != nil {
+		return err
+	}
+	if s.cgroup != nil {
+		cmdOpts = append(cmdOpts, s.cgroup.attach)
+	}
+	startTime := time.Now()
+	proc, err := RunProcess(
+		s.runDir(&s.opts.Yaml),
+		s.opts.Yaml.Start,
+		s.processEnvs(&s.opts.Yaml),
+		nil,
+		stdout,
+		stderr,
+		cmdOpts...,
+	)
+	if err != nil {
+		log.Printf("%s start run failed with err: %v", s.opts.ServiceId, err)
+		s.postStatus(s.newStoppedReq(StartFailedStopReason, err, 0, nil, startTime, nil))
+		s.reportScheduledIfIdle()
+		return err
+	}
+	s.runSeq += 1
+	run := &cronRun{
+		id:        s.runSeq,
+		proc:      proc,
+		startTime: startTime,
+		tail:      tail,
+	}
+	s.runs[run.id] = run
+	req := s.newStatusReq(RunningStatus, nil)
+	req.ProcessPid = proc.GetPid()
+	s.postStatus(req)
+	log.Printf("%s run: %d started pid: %d", s.opts.ServiceId, run.id, proc.GetPid())
+	go s.waitRunStopped(run, stdout, stderr)
+	return nil
+}
+
+func (s *Supervisor) waitRunStopped(run *cronRun, outputs ...*lineWriter) {
+	err := run.proc.Wait()
+	for _, output := range outputs {
+		output.Flush()
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	// 已被杀死
+	if s.runs[run.id] != run {
+		return
+	}
+	delete(s.runs, run.id)
+	s.reportRunStopped(run, ExitedStopReason, err, 0)
+}
+
+// reportRunStopped 上报一次执行结束 仍有其他执行时状态保持running 调用方需持有锁
+func (s *Supervisor) reportRunStopped(run *cronRun, reason StopReason, err error, stopDuration time.Duration) {
+	req := s.newStoppedReq(reason, err, stopDuration, run.proc, run.startTime, run.tail)
+	if len(s.runs) > 0 {
+		s.status = RunningStatus
+		req.Status = string(RunningStatus)
+	}
+	s.postStatus(req)
+	s.reportScheduledIfIdle()
+}
+
+// reportScheduledIfIdle 执行结束且没有其他执行时恢复为等待调度 被kill时保持停止 调用方需持有锁
+func (s *Supervisor) reportScheduledIfIdle() {
+	if len(s.runs) == 0 && s.isRunning && !s.suspended {
+		s.reportStatus(ScheduledStatus, nil)
+	}
+}
+
+// stopRuns 停止所有执行中的定时任务 等待退出期间释放锁 调用方需持有锁
+func (s *Supervisor) stopRuns() {
+	for len(s.runs) > 0 {
+		var run *cronRun
+		for _, r := range s.runs {
+			run = r
+			break
+		}
+		delete(s.runs, run.id)
+		duration := s.terminateUnlocked(run.proc)
+		s.reportRunStopped(run, KilledStopReason, nil, duration)
+	}
+}
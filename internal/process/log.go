@@ -0,0 +1,297 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logFileName     = "service.log"
+	logTimeLayout   = "2006-01-02T15:04:05.000Z07:00"
+	defaultLogSize  = 10
+	defaultLogFiles = 5
+	defaultTailSize = 4
+)
+
+type LogCfg struct {
+	// MaxSize 单个日志文件大小 单位MB
+	MaxSize int `json:"maxSize" yaml:"maxSize"`
+	// MaxFiles 保留日志文件数量
+	MaxFiles int `json:"maxFiles" yaml:"maxFiles"`
+	// TailSize 进程退出时上报的最后输出大小 单位KB
+	TailSize int `json:"tailSize,omitempty" yaml:"tailSize,omitempty"`
+}
+
+func (c *LogCfg) getMaxSize() int64 {
+	if c == nil || c.MaxSize <= 0 {
+		return defaultLogSize << 20
+	}
+	return int64(c.MaxSize) << 20
+}
+
+func (c *LogCfg) getMaxFiles() int {
+	if c == nil || c.MaxFiles <= 0 {
+		return defaultLogFiles
+	}
+	return c.MaxFiles
+}
+
+func (c *LogCfg) getTailSize() int {
+	if c == nil || c.TailSize <= 0 {
+		return defaultTailSize << 10
+	}
+	return c.TailSize << 10
+}
+
+// ServiceDir 服务数据目录
+func ServiceDir(baseDir, serviceId string) string {
+	return filepath.Join(baseDir, "services", serviceId)
+}
+
+// rotateWriter 按大小和数量滚动的日志文件
+type rotateWriter struct {
+	sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	closed   bool
+}
+
+func newRotateWriter(dir string, cfg *LogCfg) (*rotateWriter, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	ret := &rotateWriter{
+		dir:      dir,
+		maxSize:  cfg.getMaxSize(),
+		maxFiles: cfg.getMaxFiles(),
+	}
+	return ret, ret.open()
+}
+
+func (w *rotateWriter) open() error {
+	file, err := os.OpenFile(filepath.Join(w.dir, logFileName), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = stat.Size()
+	return nil
+}
+
+func (w *rotateWriter) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	base := filepath.Join(w.dir, logFileName)
+	os.Remove(fmt.Sprintf("%s.%d", base, w.maxFiles-1))
+	for i := w.maxFiles - 2; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", base, i), fmt.Sprintf("%s.%d", base, i+1))
+	}
+	if w.maxFiles > 1 {
+		os.Rename(base, base+".1")
+	} else {
+		os.Remove(base)
+	}
+	return w.open()
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil || w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	w.closed = true
+	if w.file != nil {
+		err := w.file.Close()
+		w.file = nil
+		return err
+	}
+	return nil
+}
+
+// lineWriter 按行写入 每行加上时间和输出流前缀
+type lineWriter struct {
+	stream string
+	out    io.Writer
+	buf    bytes.Buffer
+}
+
+func newLineWriter(stream string, out io.Writer) *lineWriter {
+	return &lineWriter{
+		stream: stream,
+		out:    out,
+	}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行放回缓存
+			rest := append([]byte(nil), line...)
+			w.buf.Reset()
+			w.buf.Write(rest)
+			break
+		}
+		w.writeLine(line)
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) writeLine(line []byte) {
+	prefix := time.Now().Format(logTimeLayout) + " " + w.stream + " "
+	w.out.Write(append([]byte(prefix), line...))
+}
+
+func (w *lineWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.writeLine(append(w.buf.Bytes(), '\n'))
+		w.buf.Reset()
+	}
+}
+
+// logFiles 按时间先后返回所有日志文件
+func logFiles(dir string) []string {
+	base := filepath.Join(dir, logFileName)
+	matches, _ := filepath.Glob(base + ".*")
+	ret := make([]string, 0, len(matches)+1)
+	for i := len(matches); i > 0; i-- {
+		p := fmt.Sprintf("%s.%d", base, i)
+		if _, err := os.Stat(p); err == nil {
+			ret = append(ret, p)
+		}
+	}
+	return append(ret, base)
+}
+
+func parseLogTime(line string) (time.Time, bool) {
+	field, _, b := strings.Cut(line, " ")
+	if !b {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(logTimeLayout, field)
+	return t, err == nil
+}
+
+// ReadLogLines 读取日志 since为零值不过滤时间 tail小于等于0返回全部
+func ReadLogLines(dir string, since time.Time, tail int) ([]string, error) {
+	ret := make([]string, 0)
+	for _, p := range logFiles(dir) {
+		file, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !since.IsZero() {
+				if t, b := parseLogTime(line); b && t.Before(since) {
+					continue
+				}
+			}
+			ret = append(ret, line)
+			if tail > 0 && len(ret) > tail {
+				ret = ret[1:]
+			}
+		}
+		file.Close()
+	}
+	return ret, nil
+}
+
+// FollowLog 持续读取最新日志 直到ctx结束
+func FollowLog(ctx context.Context, dir string, out io.Writer, flush func()) error {
+	p := filepath.Join(dir, logFileName)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	file, err := os.Open(p)
+	if err == nil {
+		// 已有日志从末尾开始读取
+		if _, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	// 服务还未输出日志 等待文件创建后从头读取
+	for os.IsNotExist(err) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		file, err = os.Open(p)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+	}()
+	for {
+		n, err := io.Copy(out, file)
+		if err != nil {
+			return err
+		}
+		if n > 0 && flush != nil {
+			flush()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		// 检查是否发生了滚动
+		oldStat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		newStat, err := os.Stat(p)
+		if err != nil || os.SameFile(oldStat, newStat) {
+			continue
+		}
+		io.Copy(out, file)
+		newFile, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		file.Close()
+		file = newFile
+	}
+}
@@ -0,0 +1,88 @@
+package process
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Manifest 目录中的单个配置文件
+type Manifest struct {
+	File string
+	Yaml Yaml
+	Err  error
+}
+
+// ReadYamlFile 读取并校验配置文件
+func ReadYamlFile(filePath string) (Yaml, error) {
+	var y Yaml
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return y, err
+	}
+	err = yaml.Unmarshal(content, &y)
+	if err != nil {
+		return y, err
+	}
+	return y, y.IsValid()
+}
+
+// ReadManifestDir 读取目录下所有yaml文件 不递归子目录 按文件名排序
+// 相同name或app+env的文件只有第一个生效 <文件名>.<env><扩展名>形式的覆盖文件不作为配置读取
+func ReadManifestDir(dir string) ([]Manifest, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext == ".yaml" || ext == ".yml" {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	files = skipOverlayFiles(files)
+	keys := make(map[string]string, len(files))
+	ret := make([]Manifest, 0, len(files))
+	for _, file := range files {
+		m := Manifest{
+			File: filepath.Join(dir, file),
+		}
+		m.Yaml, m.Err = ReadYamlFile(m.File)
+		if m.Err == nil {
+			key := m.Yaml.Key()
+			if prev, b := keys[key]; b {
+				m.Err = fmt.Errorf("%s is duplicated with %s", key, prev)
+			} else {
+				keys[key] = file
+			}
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// skipOverlayFiles 去掉同目录下存在<文件名><扩展名>的<文件名>.<env><扩展名>文件
+func skipOverlayFiles(files []string) []string {
+	exist := make(map[string]bool, len(files))
+	for _, file := range files {
+		exist[file] = true
+	}
+	ret := make([]string, 0, len(files))
+	for _, file := range files {
+		ext := filepath.Ext(file)
+		base := strings.TrimSuffix(file, ext)
+		if i := strings.LastIndex(base, "."); i > 0 && exist[base[:i]+ext] {
+			continue
+		}
+		ret = append(ret, file)
+	}
+	return ret
+}
@@ -1,11 +1,17 @@
 package process
 
 import (
+	"context"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,6 +20,14 @@ type ProbeType string
 const (
 	HttpProbeType ProbeType = "http"
 	TcpProbeType  ProbeType = "tcp"
+	ExecProbeType ProbeType = "exec"
+)
+
+const (
+	defaultProbeTimeout     = 3 * time.Second
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 1
+	maxProbeBodySize        = 1 << 20
 )
 
 type TcpProbe struct {
@@ -21,11 +35,21 @@ type TcpProbe struct {
 }
 
 func (t *TcpProbe) IsValid() bool {
-	return regexp.MustCompile(`^(\d{1,3}\.){3}\d{1,3}:\d+$`).MatchString(t.Host)
+	host, port, err := net.SplitHostPort(t.Host)
+	if err != nil || host == "" {
+		return false
+	}
+	p, err := strconv.Atoi(port)
+	return err == nil && p > 0 && p < 65536
 }
 
 type HttpProbe struct {
-	Url string `json:"url" yaml:"url"`
+	Url         string            `json:"url" yaml:"url"`
+	Method      string            `json:"method,omitempty" yaml:"method,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body        string            `json:"body,omitempty" yaml:"body,omitempty"`
+	StatusCodes []int             `json:"statusCodes,omitempty" yaml:"statusCodes,omitempty"`
+	BodyRegex   string            `json:"bodyRegex,omitempty" yaml:"bodyRegex,omitempty"`
 }
 
 func (t *HttpProbe) IsValid() bool {
@@ -33,48 +57,189 @@ func (t *HttpProbe) IsValid() bool {
 	if err != nil {
 		return false
 	}
+	if t.BodyRegex != "" {
+		if _, err = regexp.Compile(t.BodyRegex); err != nil {
+			return false
+		}
+	}
 	return strings.HasPrefix(parsed.Scheme, "http")
 }
 
+func (t *HttpProbe) matchStatusCode(statusCode int) bool {
+	if len(t.StatusCodes) == 0 {
+		return statusCode >= http.StatusOK && statusCode < http.StatusBadRequest
+	}
+	for _, code := range t.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *HttpProbe) run(ctx context.Context) bool {
+	method := t.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if t.Body != "" {
+		body = strings.NewReader(t.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), t.Url, body)
+	if err != nil {
+		return false
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if !t.matchStatusCode(resp.StatusCode) {
+		return false
+	}
+	if t.BodyRegex == "" {
+		return true
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if err != nil {
+		return false
+	}
+	matched, err := regexp.Match(t.BodyRegex, respBody)
+	return err == nil && matched
+}
+
+type ExecProbe struct {
+	Command string `json:"command" yaml:"command"`
+}
+
+func (t *ExecProbe) IsValid() bool {
+	return strings.TrimSpace(t.Command) != ""
+}
+
+func (t *ExecProbe) run(ctx context.Context, workdir string, envs []string, opts []CmdOption) bool {
+	var cmd *exec.Cmd
+	if strings.Count(t.Command, "\n") > 0 {
+		cmd = exec.CommandContext(ctx, "bash", "-c", t.Command)
+	} else {
+		fields := strings.Fields(t.Command)
+		cmd = exec.CommandContext(ctx, fields[0], fields[1:]...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+	// 超时杀死整个进程组
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.Dir = workdir
+	cmd.Env = append(os.Environ(), envs...)
+	if startCmd(cmd, opts) != nil {
+		return false
+	}
+	return cmd.Wait() == nil
+}
+
 type Probe struct {
-	Delay    string     `json:"delay" yaml:"delay"`
-	Interval string     `json:"interval" yaml:"interval"`
-	Type     ProbeType  `json:"type" yaml:"type"`
-	Tcp      *TcpProbe  `json:"tcp,omitempty" yaml:"tcp,omitempty"`
-	Http     *HttpProbe `json:"http,omitempty" yaml:"http,omitempty"`
+	Delay            string     `json:"delay" yaml:"delay"`
+	Interval         string     `json:"interval" yaml:"interval"`
+	Timeout          string     `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	FailureThreshold int        `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+	SuccessThreshold int        `json:"successThreshold,omitempty" yaml:"successThreshold,omitempty"`
+	Type             ProbeType  `json:"type" yaml:"type"`
+	Tcp              *TcpProbe  `json:"tcp,omitempty" yaml:"tcp,omitempty"`
+	Http             *HttpProbe `json:"http,omitempty" yaml:"http,omitempty"`
+	Exec             *ExecProbe `json:"exec,omitempty" yaml:"exec,omitempty"`
 }
 
 func (p *Probe) IsValid() bool {
+	if p.Timeout != "" {
+		if _, err := time.ParseDuration(p.Timeout); err != nil {
+			return false
+		}
+	}
+	if p.FailureThreshold < 0 || p.SuccessThreshold < 0 {
+		return false
+	}
 	switch p.Type {
 	case HttpProbeType:
 		return p.Http != nil && p.Http.IsValid()
 	case TcpProbeType:
 		return p.Tcp != nil && p.Tcp.IsValid()
+	case ExecProbeType:
+		return p.Exec != nil && p.Exec.IsValid()
 	default:
 		return false
 	}
 }
 
-func (p *Probe) run() bool {
+func (p *Probe) getDelay(defaultDelay time.Duration) time.Duration {
+	if p.Delay == "" {
+		return defaultDelay
+	}
+	delay, err := time.ParseDuration(p.Delay)
+	if err != nil || delay < 0 {
+		return defaultDelay
+	}
+	return delay
+}
+
+func (p *Probe) getInterval() time.Duration {
+	interval, err := time.ParseDuration(p.Interval)
+	if err != nil || interval < time.Second {
+		return 5 * time.Second
+	}
+	return interval
+}
+
+func (p *Probe) getTimeout() time.Duration {
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil || timeout <= 0 {
+		return defaultProbeTimeout
+	}
+	return timeout
+}
+
+func (p *Probe) getFailureThreshold() int {
+	if p.FailureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+	return p.FailureThreshold
+}
+
+func (p *Probe) getSuccessThreshold() int {
+	if p.SuccessThreshold <= 0 {
+		return defaultSuccessThreshold
+	}
+	return p.SuccessThreshold
+}
+
+// run opts为服务的运行用户 只对exec探针生效
+func (p *Probe) run(workdir string, envs []string, opts []CmdOption) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.getTimeout())
+	defer cancel()
 	switch p.Type {
 	case HttpProbeType:
 		if p.Http != nil {
-			resp, err := http.Get(p.Http.Url)
-			if err != nil {
-				return false
-			}
-			defer resp.Body.Close()
-			return resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest
+			return p.Http.run(ctx)
 		}
 	case TcpProbeType:
 		if p.Tcp != nil {
-			conn, err := net.DialTimeout("tcp", p.Tcp.Host, time.Second)
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", p.Tcp.Host)
 			if err != nil {
 				return false
 			}
 			defer conn.Close()
 			return true
 		}
+	case ExecProbeType:
+		if p.Exec != nil {
+			return p.Exec.run(ctx, workdir, envs, opts)
+		}
 	}
 	return false
 }
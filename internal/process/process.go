@@ -1,28 +1,52 @@
 package process
 
 import (
-	"bytes"
 	"errors"
 	"github.com/LeeZXin/zallet/internal/util"
 	"io"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
 	"syscall"
+	"time"
 )
 
 type Status string
 
 const (
-	StartingStatus Status = "starting"
-	RunningStatus  Status = "running"
-	StoppingStatus Status = "stopping"
-	StoppedStatus  Status = "stopped"
+	StartingStatus  Status = "starting"
+	RunningStatus   Status = "running"
+	UnhealthyStatus Status = "unhealthy" // 存活探针失败但未达到重启阈值
+	StoppingStatus  Status = "stopping"
+	StoppedStatus   Status = "stopped"
+	CrashLoopStatus Status = "crashLoop" // 重启次数用尽
+	SucceededStatus Status = "succeeded" // 任务以退出码0结束
+	ScheduledStatus Status = "scheduled" // 定时任务等待调度
+	PendingStatus   Status = "pending"   // 全局调度的服务等待实例认领
 )
 
+type StopReason string
+
+const (
+	ExitedStopReason         StopReason = "exited"         // 进程自己退出
+	KilledStopReason         StopReason = "killed"         // 进程被supervisor杀死
+	OOMKilledStopReason      StopReason = "oomKilled"      // 超出cgroup内存限制被杀死
+	StartFailedStopReason    StopReason = "startFailed"    // 进程启动失败
+	SupervisorLostStopReason StopReason = "supervisorLost" // zallet重启时supervisor已不存在
+	InstanceLostStopReason   StopReason = "instanceLost"   // 所在实例长时间停止心跳
+)
+
+// CmdOption 进程启动前的额外设置 在同一个锁定的线程中执行
+// 返回的函数在进程启动后对子进程执行 失败时杀死子进程
+type CmdOption func(*exec.Cmd) (func(pid int) error, error)
+
 type Process struct {
-	Cmd     *exec.Cmd
-	errChan chan error
+	Cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+	// exit 由等待进程的goroutine在关闭done前写入
+	exit ExitInfo
 }
 
 func (p *Process) Kill() error {
@@ -32,6 +56,14 @@ func (p *Process) Kill() error {
 	return nil
 }
 
+// Terminate 向进程组发送信号 等待进程组退出 超时后强制杀死
+func (p *Process) Terminate(sig syscall.Signal, timeout time.Duration) error {
+	if p.Cmd.Process != nil {
+		return util.TerminateNegativePid(p.Cmd.Process.Pid, sig, timeout)
+	}
+	return nil
+}
+
 func (p *Process) GetPid() int {
 	if p == nil {
 		return 0
@@ -43,17 +75,18 @@ func (p *Process) GetPid() int {
 	return 0
 }
 
+// Wait 等待进程退出 可被多次调用
 func (p *Process) Wait() error {
-	select {
-	case err, ok := <-p.errChan:
-		if !ok {
-			return errors.New("process is down")
-		}
-		return err
-	}
+	<-p.done
+	return p.err
+}
+
+// Done 进程退出后关闭
+func (p *Process) Done() <-chan struct{} {
+	return p.done
 }
 
-func RunProcess(workDir, script string, envs []string, stdin io.Reader) (*Process, error) {
+func RunProcess(workDir, script string, envs []string, stdin io.Reader, stdout, stderr io.Writer, opts ...CmdOption) (*Process, error) {
 	if script == "" {
 		return nil, errors.New("empty script")
 	}
@@ -71,9 +104,9 @@ func RunProcess(workDir, script string, envs []string, stdin io.Reader) (*Proces
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
-	stderr := new(bytes.Buffer)
 	cmd.Dir = workDir
 	cmd.Stdin = stdin
+	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	if len(envs) > 0 {
 		cmd.Env = append(os.Environ(), envs...)
@@ -81,27 +114,56 @@ func RunProcess(workDir, script string, envs []string, stdin io.Reader) (*Proces
 		cmd.Env = os.Environ()
 	}
 	// 先启动命令
-	err := cmd.Start()
+	err := startCmd(cmd, opts)
 	if err != nil {
 		return nil, err
 	}
 	ret := &Process{
-		Cmd:     cmd,
-		errChan: make(chan error, 1),
+		Cmd:  cmd,
+		done: make(chan struct{}),
 	}
 	go func() {
-		defer close(ret.errChan)
-		err2 := cmd.Wait()
-		if err2 != nil && stderr.Len() > 0 {
-			err2 = errors.New(stderr.String())
+		defer close(ret.done)
+		// 保留*exec.ExitError 便于获取退出码和信号
+		ret.err = cmd.Wait()
+		ret.exit = newExitInfo(cmd.ProcessState)
+	}()
+	return ret, nil
+}
+
+// startCmd 在锁定的线程中启动进程 子进程会继承该线程的nice值和cpu亲和性
+func startCmd(cmd *exec.Cmd, opts []CmdOption) error {
+	if len(opts) == 0 {
+		return cmd.Start()
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		// 线程属性已被修改 不解锁 goroutine结束后线程随之销毁
+		runtime.LockOSThread()
+		hooks := make([]func(int) error, 0, len(opts))
+		for _, opt := range opts {
+			hook, err := opt(cmd)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			if hook != nil {
+				hooks = append(hooks, hook)
+			}
 		}
-		transferErr := func(e error) {
-			defer func() {
-				recover()
-			}()
-			ret.errChan <- e
+		if err := cmd.Start(); err != nil {
+			errChan <- err
+			return
 		}
-		transferErr(err2)
+		for _, hook := range hooks {
+			if err := hook(cmd.Process.Pid); err != nil {
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				cmd.Wait()
+				errChan <- err
+				return
+			}
+		}
+		errChan <- nil
 	}()
-	return ret, nil
+	return <-errChan
 }
@@ -0,0 +1,127 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// RenderOpts 渲染配置文件的参数
+type RenderOpts struct {
+	// ValuesFiles 模版变量文件 后面的覆盖前面的
+	ValuesFiles []string
+	// Sets key=val形式的变量 key可用.表示层级 val按字符串处理 优先级最高
+	Sets []string
+	// Overlay 按env覆盖的配置文件 为空时使用同目录下的<文件名>.<env><扩展名>
+	Overlay string
+}
+
+// RenderYamlFile 使用text/template渲染配置文件 再合并env对应的覆盖文件 最后校验
+func RenderYamlFile(filePath string, opts RenderOpts) (Yaml, error) {
+	var y Yaml
+	values, err := loadValues(opts)
+	if err != nil {
+		return y, err
+	}
+	base, err := renderYamlMap(filePath, values)
+	if err != nil {
+		return y, err
+	}
+	env, _ := base["env"].(string)
+	overlay := opts.Overlay
+	if overlay == "" && env != "" {
+		ext := filepath.Ext(filePath)
+		overlay = strings.TrimSuffix(filePath, ext) + "." + env + ext
+		if _, err = os.Stat(overlay); err != nil {
+			overlay = ""
+		}
+	}
+	if overlay != "" {
+		m, err := renderYamlMap(overlay, values)
+		if err != nil {
+			return y, err
+		}
+		mergeMap(base, m)
+	}
+	content, err := yaml.Marshal(base)
+	if err != nil {
+		return y, err
+	}
+	err = yaml.Unmarshal(content, &y)
+	if err != nil {
+		return y, err
+	}
+	return y, y.IsValid()
+}
+
+func loadValues(opts RenderOpts) (map[string]any, error) {
+	values := make(map[string]any)
+	for _, file := range opts.ValuesFiles {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]any)
+		if err = yaml.Unmarshal(content, &m); err != nil {
+			return nil, fmt.Errorf("invalid values file %s: %v", file, err)
+		}
+		mergeMap(values, m)
+	}
+	for _, set := range opts.Sets {
+		key, val, b := strings.Cut(set, "=")
+		if !b || key == "" {
+			return nil, fmt.Errorf("invalid set: %s", set)
+		}
+		fields := strings.Split(key, ".")
+		m := values
+		for _, field := range fields[:len(fields)-1] {
+			next, ok := m[field].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				m[field] = next
+			}
+			m = next
+		}
+		m[fields[len(fields)-1]] = val
+	}
+	return values, nil
+}
+
+// renderYamlMap 先渲染模版 再解析成map 没有变量时引用变量同样报错
+func renderYamlMap(filePath string, values map[string]any) (map[string]any, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	tpl, err := template.New(filepath.Base(filePath)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = tpl.Execute(buf, values); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]any)
+	if err = yaml.Unmarshal(buf.Bytes(), &ret); err != nil {
+		return nil, fmt.Errorf("invalid yaml %s: %v", filePath, err)
+	}
+	return ret, nil
+}
+
+// mergeMap 把src合并到dst map递归合并 其他类型直接覆盖
+func mergeMap(dst, src map[string]any) {
+	for k, v := range src {
+		srcMap, ok := v.(map[string]any)
+		if ok {
+			if dstMap, ok := dst[k].(map[string]any); ok {
+				mergeMap(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
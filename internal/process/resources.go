@@ -0,0 +1,162 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCgroupSlice = "zallet.slice"
+	defaultCpuPeriod   = 100000
+)
+
+type CpuResource struct {
+	// Quota 每个周期可用cpu时间 单位us
+	Quota int64 `json:"quota,omitempty" yaml:"quota,omitempty"`
+	// Period 周期 单位us
+	Period int64 `json:"period,omitempty" yaml:"period,omitempty"`
+	// Cores 可用核数 与quota二选一
+	Cores float64 `json:"cores,omitempty" yaml:"cores,omitempty"`
+}
+
+func (r *CpuResource) IsValid() error {
+	if r.Quota < 0 || r.Period < 0 || r.Cores < 0 {
+		return errors.New("invalid cpu resource")
+	}
+	if r.Quota > 0 && r.Cores > 0 {
+		return errors.New("cpu quota and cores are mutually exclusive")
+	}
+	return nil
+}
+
+// cpuMax cgroup cpu.max内容
+func (r *CpuResource) cpuMax() string {
+	period := r.Period
+	if period <= 0 {
+		period = defaultCpuPeriod
+	}
+	quota := r.Quota
+	if r.Cores > 0 {
+		quota = int64(r.Cores * float64(period))
+	}
+	if quota <= 0 {
+		return fmt.Sprintf("max %d", period)
+	}
+	return fmt.Sprintf("%d %d", quota, period)
+}
+
+type MemoryResource struct {
+	Max  string `json:"max,omitempty" yaml:"max,omitempty"`
+	High string `json:"high,omitempty" yaml:"high,omitempty"`
+}
+
+func (r *MemoryResource) IsValid() error {
+	for _, size := range []string{r.Max, r.High} {
+		if size == "" {
+			continue
+		}
+		if _, err := util.ParseByteSize(size); err != nil {
+			return fmt.Errorf("invalid memory resource: %s", size)
+		}
+	}
+	return nil
+}
+
+type IoResource struct {
+	// Weight 取值范围1-10000
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+func (r *IoResource) IsValid() error {
+	if r.Weight < 0 || r.Weight > 10000 {
+		return fmt.Errorf("invalid io weight: %d", r.Weight)
+	}
+	return nil
+}
+
+type ResourcesCfg struct {
+	Cpu    *CpuResource    `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Memory *MemoryResource `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Pids   int64           `json:"pids,omitempty" yaml:"pids,omitempty"`
+	Io     *IoResource     `json:"io,omitempty" yaml:"io,omitempty"`
+}
+
+func (c *ResourcesCfg) IsValid() error {
+	if c.Cpu != nil {
+		if err := c.Cpu.IsValid(); err != nil {
+			return err
+		}
+	}
+	if c.Memory != nil {
+		if err := c.Memory.IsValid(); err != nil {
+			return err
+		}
+	}
+	if c.Pids < 0 {
+		return fmt.Errorf("invalid pids: %d", c.Pids)
+	}
+	if c.Io != nil {
+		if err := c.Io.IsValid(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// controlFiles 需要写入cgroup的控制文件
+func (c *ResourcesCfg) controlFiles() map[string]string {
+	ret := make(map[string]string)
+	if c.Cpu != nil {
+		ret["cpu.max"] = c.Cpu.cpuMax()
+	}
+	if c.Memory != nil {
+		if c.Memory.Max != "" {
+			size, _ := util.ParseByteSize(c.Memory.Max)
+			ret["memory.max"] = strconv.FormatInt(size, 10)
+		}
+		if c.Memory.High != "" {
+			size, _ := util.ParseByteSize(c.Memory.High)
+			ret["memory.high"] = strconv.FormatInt(size, 10)
+		}
+	}
+	if c.Pids > 0 {
+		ret["pids.max"] = strconv.FormatInt(c.Pids, 10)
+	}
+	if c.Io != nil && c.Io.Weight > 0 {
+		ret["io.weight"] = fmt.Sprintf("default %d", c.Io.Weight)
+	}
+	return ret
+}
+
+// controllers 需要开启的cgroup控制器
+func (c *ResourcesCfg) controllers() []string {
+	ret := make([]string, 0, 4)
+	for file := range c.controlFiles() {
+		controller, _, _ := strings.Cut(file, ".")
+		if !util.FindInSlice(ret, controller) {
+			ret = append(ret, controller)
+		}
+	}
+	// 检测oom需要memory控制器
+	if !util.FindInSlice(ret, "memory") {
+		ret = append(ret, "memory")
+	}
+	return ret
+}
+
+// OOMKilledErr 进程因超出内存限制被杀死
+type OOMKilledErr struct {
+	MemoryEvents map[string]int64
+}
+
+func (e *OOMKilledErr) Error() string {
+	keys := []string{"low", "high", "max", "oom", "oom_kill"}
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%d", key, e.MemoryEvents[key]))
+	}
+	return "oom killed, memory.events: " + strings.Join(fields, " ")
+}
@@ -0,0 +1,68 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCpuMax(t *testing.T) {
+	tests := []struct {
+		name     string
+		cpu      CpuResource
+		expected string
+	}{
+		{"unlimited", CpuResource{}, "max 100000"},
+		{"unlimited with period", CpuResource{Period: 50000}, "max 50000"},
+		{"quota", CpuResource{Quota: 20000}, "20000 100000"},
+		{"quota with period", CpuResource{Quota: 20000, Period: 50000}, "20000 50000"},
+		{"cores", CpuResource{Cores: 1.5}, "150000 100000"},
+		{"cores with period", CpuResource{Cores: 0.5, Period: 200000}, "100000 200000"},
+	}
+	for _, tt := range tests {
+		if got := tt.cpu.cpuMax(); got != tt.expected {
+			t.Errorf("%s: cpuMax() = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestControlFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ResourcesCfg
+		expected map[string]string
+	}{
+		{"empty", ResourcesCfg{}, map[string]string{}},
+		{
+			name: "memory",
+			cfg:  ResourcesCfg{Memory: &MemoryResource{Max: "512M", High: "1G"}},
+			expected: map[string]string{
+				"memory.max":  "536870912",
+				"memory.high": "1073741824",
+			},
+		},
+		{
+			name:     "memory max only",
+			cfg:      ResourcesCfg{Memory: &MemoryResource{Max: "1024"}},
+			expected: map[string]string{"memory.max": "1024"},
+		},
+		{
+			name: "all",
+			cfg: ResourcesCfg{
+				Cpu:  &CpuResource{Cores: 2},
+				Pids: 100,
+				Io:   &IoResource{Weight: 200},
+			},
+			expected: map[string]string{
+				"cpu.max":   "200000 100000",
+				"pids.max":  "100",
+				"io.weight": "default 200",
+			},
+		},
+		{"zero io weight", ResourcesCfg{Io: &IoResource{}}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.controlFiles(); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: controlFiles() = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+type RestartPolicy string
+
+const (
+	AlwaysRestartPolicy    RestartPolicy = "always"
+	OnFailureRestartPolicy RestartPolicy = "on-failure"
+	NeverRestartPolicy     RestartPolicy = "never"
+)
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+)
+
+type RestartCfg struct {
+	Policy RestartPolicy `json:"policy" yaml:"policy"`
+	// MaxRetries 最大连续重启次数 0为不限制
+	MaxRetries int `json:"maxRetries" yaml:"maxRetries"`
+	// InitialBackoff 首次重启等待时间 之后每次翻倍
+	InitialBackoff string `json:"initialBackoff" yaml:"initialBackoff"`
+	// MaxBackoff 最大重启等待时间
+	MaxBackoff string `json:"maxBackoff" yaml:"maxBackoff"`
+	// ResetWindow 进程持续运行超过该时间后 重置重启次数
+	ResetWindow string `json:"resetWindow" yaml:"resetWindow"`
+}
+
+func (c *RestartCfg) IsValid() error {
+	switch c.Policy {
+	case AlwaysRestartPolicy, OnFailureRestartPolicy, NeverRestartPolicy:
+	default:
+		return fmt.Errorf("invalid restart policy: %s", c.Policy)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid restart maxRetries: %d", c.MaxRetries)
+	}
+	for _, d := range []string{c.InitialBackoff, c.MaxBackoff, c.ResetWindow} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid restart duration: %s", d)
+		}
+	}
+	return nil
+}
+
+func (c *RestartCfg) ShouldRestart(exitErr error) bool {
+	if c == nil {
+		return false
+	}
+	switch c.Policy {
+	case AlwaysRestartPolicy:
+		return true
+	case OnFailureRestartPolicy:
+		return exitErr != nil
+	default:
+		return false
+	}
+}
+
+func (c *RestartCfg) getResetWindow() time.Duration {
+	ret, _ := time.ParseDuration(c.ResetWindow)
+	return ret
+}
+
+// backoff 第retries次重启前的等待时间
+func (c *RestartCfg) backoff(retries int) time.Duration {
+	initial, err := time.ParseDuration(c.InitialBackoff)
+	if err != nil || initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	max, err := time.ParseDuration(c.MaxBackoff)
+	if err != nil || max <= 0 {
+		max = defaultMaxBackoff
+	}
+	ret := initial
+	for i := 0; i < retries && ret < max; i++ {
+		ret *= 2
+	}
+	if ret > max {
+		ret = max
+	}
+	return ret
+}
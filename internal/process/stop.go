@@ -0,0 +1,57 @@
+package process
+
+import (
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/util"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultStopTimeout = 30 * time.Second
+)
+
+type StopCfg struct {
+	// Signal 停止信号 默认SIGTERM
+	Signal string `json:"signal,omitempty" yaml:"signal,omitempty"`
+	// Timeout 等待进程组退出的时间 包含preStop的执行时间 超时后发送SIGKILL
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// PreStop 发送停止信号前执行的脚本
+	PreStop string `json:"preStop,omitempty" yaml:"preStop,omitempty"`
+}
+
+func (c *StopCfg) IsValid() error {
+	if c.Signal != "" {
+		if _, err := util.ParseSignal(c.Signal); err != nil {
+			return err
+		}
+	}
+	if c.Timeout != "" {
+		if timeout, err := time.ParseDuration(c.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid stop timeout: %s", c.Timeout)
+		}
+	}
+	return nil
+}
+
+func (c *StopCfg) getSignal() syscall.Signal {
+	if c == nil || c.Signal == "" {
+		return syscall.SIGTERM
+	}
+	sig, err := util.ParseSignal(c.Signal)
+	if err != nil {
+		return syscall.SIGTERM
+	}
+	return sig
+}
+
+func (c *StopCfg) GetTimeout() time.Duration {
+	if c == nil {
+		return defaultStopTimeout
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout <= 0 {
+		return defaultStopTimeout
+	}
+	return timeout
+}
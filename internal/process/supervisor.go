@@ -9,14 +9,22 @@ import (
 	"github.com/LeeZXin/zallet/internal/global"
 	"github.com/LeeZXin/zallet/internal/util"
 	"github.com/shirou/gopsutil/v3/process"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+const (
+	maxPendingReports = 1024
+	ReplicaIndexEnv   = "ZALLET_REPLICA_INDEX"
+)
+
 type Supervisor struct {
 	opts           ServiceOpts
 	pid            int
@@ -24,29 +32,62 @@ type Supervisor struct {
 	supvCancelFunc context.CancelFunc
 	httpClient     *http.Client
 	startTime      time.Time
+	procStartTime  time.Time
+	retries        int
+	restartTimer   *time.Timer
 	locker         sync.Mutex
+	// opLocker 串行执行kill reload等操作 停止进程期间会释放locker
+	opLocker sync.Mutex
+	// stopping 正在停止的进程数 停止完成时通过stopCond通知
+	stopping int
+	// killSeq 每次kill递增 释放锁下载artifact期间被kill时放弃启动
+	killSeq        int64
+	stopCond       *sync.Cond
+	reportLocker   sync.Mutex
+	pendingReports []global.ReportStatusReq
+	probeLocker    sync.Mutex
+	probeStates    map[string]ProbeState
+	controlSrv     *http.Server
 	process        *Process
+	outputTail     *tailBuffer
+	runs           map[int64]*cronRun
+	runSeq         int64
+	logger         *rotateWriter
+	cgroup         *cgroup
+	oomKills       int64
 	processRunning bool
+	status         Status
 	isRunning      bool
 	ShutdownChan   chan struct{}
+	// suspended 定时任务被kill后不再触发执行 重启或重新加载后恢复
+	suspended bool
+	// eventSeq 每次上报递增 同一毫秒内的上报按序号先后生效
+	eventSeq int64
 }
 
 func NewSupervisor(opts ServiceOpts) *Supervisor {
-	return &Supervisor{
+	ret := &Supervisor{
 		opts:         opts,
 		pid:          os.Getpid(),
 		startTime:    time.Now(),
 		httpClient:   util.NewUnixHttpClient(opts.SockFile),
 		ShutdownChan: make(chan struct{}),
+		probeStates:  make(map[string]ProbeState),
+		runs:         make(map[int64]*cronRun),
 		isRunning:    true,
 	}
+	ret.stopCond = sync.NewCond(&ret.locker)
+	return ret
 }
 
 type ServiceOpts struct {
-	ServiceId string `json:"serviceId"`
-	Yaml      Yaml   `json:"yaml"`
-	BaseDir   string `json:"baseDir"`
-	SockFile  string `json:"sockFile"`
+	ServiceId   string `json:"serviceId"`
+	Yaml        Yaml   `json:"yaml"`
+	BaseDir     string `json:"baseDir"`
+	SockFile    string `json:"sockFile"`
+	CgroupSlice string `json:"cgroupSlice"`
+	// ReplicaIndex 副本序号 通过ZALLET_REPLICA_INDEX传给进程
+	ReplicaIndex int `json:"replicaIndex"`
 }
 
 func (o *ServiceOpts) IsValid() error {
@@ -75,17 +116,56 @@ func (s *Supervisor) healthCheck() bool {
 }
 
 func (s *Supervisor) reportStatus(status Status, err error) {
+	s.postStatus(s.newStatusReq(status, err))
+}
+
+// reportStopped 上报停止状态 停止原因及停止耗时 进程已退出时附带退出信息和最后的输出
+func (s *Supervisor) reportStopped(reason StopReason, err error, stopDuration time.Duration, proc *Process, tail *tailBuffer) {
+	s.postStatus(s.newStoppedReq(reason, err, stopDuration, proc, s.procStartTime, tail))
+}
+
+// newStoppedReq 停止状态 job和cron附带本次执行的开始时间 自行以退出码0结束时为succeeded
+func (s *Supervisor) newStoppedReq(reason StopReason, err error, stopDuration time.Duration, proc *Process, startTime time.Time, tail *tailBuffer) global.ReportStatusReq {
+	status := StoppedStatus
+	runOnce := s.opts.Yaml.IsRunOnce()
+	if runOnce && reason == ExitedStopReason && err == nil {
+		status = SucceededStatus
+	}
+	req := s.newStatusReq(status, err)
+	req.StopReason = string(reason)
+	req.StopDuration = stopDuration.Milliseconds()
+	req.ExitCode = -1
+	if proc != nil {
+		info := proc.ExitInfo()
+		req.ExitCode = info.ExitCode
+		req.Signal = info.Signal
+		req.CoreDumped = info.CoreDumped
+		req.Runtime = time.Since(startTime).Milliseconds()
+		log.Printf("%s process exited with code: %d signal: %s runtime: %dms", s.opts.ServiceId, info.ExitCode, info.Signal, req.Runtime)
+	}
+	if tail != nil {
+		req.OutputTail = tail.String()
+	}
+	if runOnce {
+		req.RunStartTime = startTime.UnixMilli()
+	}
+	return req
+}
+
+func (s *Supervisor) newStatusReq(status Status, err error) global.ReportStatusReq {
+	s.status = status
 	req := global.ReportStatusReq{
 		ServiceId:  s.opts.ServiceId,
 		Pid:        s.pid,
 		ProcessPid: s.process.GetPid(),
 		EventTime:  time.Now().UnixMilli(),
+		EventSeq:   atomic.AddInt64(&s.eventSeq, 1),
 		Status:     string(status),
 	}
 	if err != nil {
 		req.ErrLog = err.Error()
 	}
-	if status == RunningStatus {
+	if status == RunningStatus || status == UnhealthyStatus {
 		pid := s.process.GetPid()
 		if pid > 0 {
 			pcs, err := process.NewProcess(int32(pid))
@@ -101,65 +181,177 @@ func (s *Supervisor) reportStatus(status Status, err error) {
 			}
 		}
 	}
+	return req
+}
+
+// postStatus 上报状态 zallet不可用时缓存 恢复后按顺序补报
+func (s *Supervisor) postStatus(req global.ReportStatusReq) {
+	s.reportLocker.Lock()
+	defer s.reportLocker.Unlock()
+	s.flushPendingReports()
+	if len(s.pendingReports) == 0 && s.sendStatus(req) {
+		return
+	}
+	s.pendingReports = append(s.pendingReports, req)
+	if len(s.pendingReports) > maxPendingReports {
+		s.pendingReports = s.pendingReports[len(s.pendingReports)-maxPendingReports:]
+	}
+}
+
+func (s *Supervisor) sendStatus(req global.ReportStatusReq) bool {
 	m, _ := json.Marshal(req)
 	resp, err := s.httpClient.Post(
 		"http://fake/api/v1/reportStatus",
 		"application/json;charset=utf-8",
 		bytes.NewReader(m),
 	)
-	if err == nil {
-		resp.Body.Close()
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// flushPendingReports 补报缓存的状态 调用方需持有reportLocker
+func (s *Supervisor) flushPendingReports() {
+	for len(s.pendingReports) > 0 {
+		if !s.sendStatus(s.pendingReports[0]) {
+			return
+		}
+		s.pendingReports = s.pendingReports[1:]
 	}
 }
 
 func (s *Supervisor) Run() error {
+	var err error
+	// 日志输出
+	s.logger, err = newRotateWriter(ServiceDir(s.opts.BaseDir, s.opts.ServiceId), s.opts.Yaml.Log)
+	if err != nil {
+		return err
+	}
+	// 资源限制
+	if s.opts.Yaml.Resources != nil {
+		s.cgroup, err = newCgroup(s.opts.CgroupSlice, s.opts.ServiceId, s.opts.Yaml.Resources)
+		if err != nil {
+			return err
+		}
+	}
+	// 控制通道
+	err = s.startControlServer()
+	if err != nil {
+		return err
+	}
 	var ctx context.Context
 	ctx, s.supvCancelFunc = context.WithCancel(context.Background())
-	// 启动心跳检查
-	if s.opts.Yaml.Probe != nil {
-		go s.runProbe(ctx)
-	}
 	// 启动后端健康检查
 	go s.runHealthCheck(ctx)
-	return s.startProcess()
+	err = s.startProcess()
+	if err != nil {
+		// 下载artifact等失败时按重启策略重试 不退出supervisor
+		log.Printf("%s start process failed with err: %v", s.opts.ServiceId, err)
+		s.locker.Lock()
+		defer s.locker.Unlock()
+		s.reportStopped(StartFailedStopReason, err, 0, nil, nil)
+		s.scheduleRestart(err)
+	}
+	return nil
 }
 
 func (s *Supervisor) startProcess() error {
 	s.locker.Lock()
 	defer s.locker.Unlock()
+	return s.startProcessLocked()
+}
+
+func (s *Supervisor) startProcessLocked() error {
+	// 旧进程完全退出后再启动 避免端口等资源冲突
+	s.waitStopping()
 	if !s.isRunning {
 		return errors.New("supervisor closed")
 	}
 	if s.processRunning {
 		return nil
 	}
+	// 下载并切换到配置的版本
+	if s.opts.Yaml.Artifact != nil {
+		started, err := s.fetchArtifactUnlocked()
+		if err != nil || !started {
+			return err
+		}
+		if err = s.activateRelease(&s.opts.Yaml); err != nil {
+			return err
+		}
+	}
+	// 定时任务由zallet触发执行
+	if s.opts.Yaml.GetType() == CronServiceType {
+		s.suspended = false
+		if len(s.runs) == 0 {
+			s.reportStatus(ScheduledStatus, nil)
+		}
+		return nil
+	}
 	var ctx context.Context
 	ctx, s.procCancelFunc = context.WithCancel(context.Background())
+	s.procStartTime = time.Now()
 	s.reportStatus(StartingStatus, nil)
+	// 合并输出的最后部分 进程退出时上报
+	tail := newTailBuffer(s.opts.Yaml.Log.getTailSize())
+	stdout := newLineWriter("stdout", io.MultiWriter(s.logger, tail))
+	stderr := newLineWriter("stderr", io.MultiWriter(s.logger, tail))
+	cmdOpts, err := s.opts.Yaml.sysAttrOptions()
+	if err != nil {
+		return err
+	}
+	if s.cgroup != nil {
+		s.oomKills = s.cgroup.memoryEvents()["oom_kill"]
+		cmdOpts = append(cmdOpts, s.cgroup.attach)
+	}
 	// 执行启动命令
 	proc, err := RunProcess(
-		s.opts.Yaml.Workdir,
+		s.runDir(&s.opts.Yaml),
 		s.opts.Yaml.Start,
-		util.MergeEnvs(s.opts.Yaml.With),
+		s.processEnvs(&s.opts.Yaml),
 		nil,
+		stdout,
+		stderr,
+		cmdOpts...,
 	)
 	if err != nil {
 		return err
 	}
 	s.process = proc
-	s.reportStatus(RunningStatus, nil)
+	s.outputTail = tail
 	s.processRunning = true
+	if s.opts.Yaml.Readiness != nil {
+		// 就绪探针通过后才算running
+		go s.runReadiness(ctx, s.opts.Yaml)
+	} else {
+		s.markReady(ctx)
+	}
 	go s.reportCpuAndMem(ctx)
-	go s.waitProcessStopped(proc)
+	go s.waitProcessStopped(proc, stdout, stderr)
 	return nil
 }
 
+// processEnvs 进程及探针的环境变量
+func (s *Supervisor) processEnvs(y *Yaml) []string {
+	return append(util.MergeEnvs(y.With), fmt.Sprintf("%s=%d", ReplicaIndexEnv, s.opts.ReplicaIndex))
+}
+
+// markReady 进程就绪 调用方需持有锁
+func (s *Supervisor) markReady(ctx context.Context) {
+	s.reportStatus(RunningStatus, nil)
+	if liveness := s.opts.Yaml.getLiveness(); liveness != nil {
+		go s.runLiveness(ctx, liveness, s.opts.Yaml)
+	}
+}
+
 func (s *Supervisor) reportCpuAndMem(ctx context.Context) {
 	fn := func() {
 		s.locker.Lock()
 		defer s.locker.Unlock()
 		if s.processRunning {
-			s.reportStatus(RunningStatus, nil)
+			s.reportStatus(s.status, nil)
 		}
 	}
 	time.Sleep(5 * time.Second)
@@ -169,8 +361,11 @@ func (s *Supervisor) reportCpuAndMem(ctx context.Context) {
 	}
 }
 
-func (s *Supervisor) waitProcessStopped(process *Process) error {
+func (s *Supervisor) waitProcessStopped(process *Process, outputs ...*lineWriter) error {
 	err := process.Wait()
+	for _, output := range outputs {
+		output.Flush()
+	}
 	s.locker.Lock()
 	defer s.locker.Unlock()
 	// 并发问题可能导致不是原来的进程
@@ -183,97 +378,379 @@ func (s *Supervisor) waitProcessStopped(process *Process) error {
 	if !s.processRunning {
 		return nil
 	}
+	tail := s.outputTail
 	s.processRunning = false
 	s.process = nil
+	s.outputTail = nil
 	s.procCancelFunc()
-	s.reportStatus(StoppedStatus, err)
+	reason := ExitedStopReason
+	if s.cgroup != nil {
+		// 检查是否因oom被杀死
+		events := s.cgroup.memoryEvents()
+		if events["oom_kill"] > s.oomKills {
+			reason = OOMKilledStopReason
+			err = &OOMKilledErr{
+				MemoryEvents: events,
+			}
+		}
+	}
+	s.reportStopped(reason, err, 0, process, tail)
+	// job成功结束后不再重启
+	if s.opts.Yaml.GetType() == JobServiceType && reason == ExitedStopReason && err == nil {
+		return nil
+	}
+	s.scheduleRestart(err)
 	return nil
 }
 
+// scheduleRestart 根据重启策略延迟重启进程 调用方需持有锁
+func (s *Supervisor) scheduleRestart(exitErr error) {
+	cfg := s.opts.Yaml.Restart
+	if !cfg.ShouldRestart(exitErr) {
+		return
+	}
+	resetWindow := cfg.getResetWindow()
+	if resetWindow > 0 && time.Since(s.procStartTime) >= resetWindow {
+		s.retries = 0
+	}
+	if cfg.MaxRetries > 0 && s.retries >= cfg.MaxRetries {
+		log.Printf("%s restart retries exhausted: %d", s.opts.ServiceId, s.retries)
+		s.reportStatus(CrashLoopStatus, exitErr)
+		return
+	}
+	backoff := cfg.backoff(s.retries)
+	s.retries += 1
+	log.Printf("%s restart process after %v retries: %d", s.opts.ServiceId, backoff, s.retries)
+	s.restartTimer = time.AfterFunc(backoff, func() {
+		err := s.startProcess()
+		if err == nil {
+			return
+		}
+		log.Printf("%s restart process failed with err: %v", s.opts.ServiceId, err)
+		s.locker.Lock()
+		defer s.locker.Unlock()
+		if s.isRunning && !s.processRunning {
+			s.reportStopped(StartFailedStopReason, err, 0, nil, nil)
+			s.scheduleRestart(err)
+		}
+	})
+}
+
+func (s *Supervisor) stopRestartTimer() {
+	if s.restartTimer != nil {
+		s.restartTimer.Stop()
+		s.restartTimer = nil
+	}
+}
+
 func (s *Supervisor) KillProcess() error {
+	s.opLocker.Lock()
+	defer s.opLocker.Unlock()
 	s.locker.Lock()
 	defer s.locker.Unlock()
 	if !s.isRunning {
 		return errors.New("supervisor closed")
 	}
+	s.suspended = true
 	s.killProcess()
+	// 没有运行中的进程时 如定时任务等待调度或正在下载artifact 仍需标记为停止
+	switch s.status {
+	case StoppedStatus, SucceededStatus, CrashLoopStatus:
+	default:
+		req := s.newStatusReq(StoppedStatus, nil)
+		req.StopReason = string(KilledStopReason)
+		s.postStatus(req)
+	}
 	return nil
 }
 
+// killProcess 停止进程和执行中的定时任务 调用方需持有锁
 func (s *Supervisor) killProcess() {
+	s.killSeq += 1
+	s.stopRestartTimer()
+	s.stopProcess(nil)
+	s.stopRuns()
+	// 等待其他协程中的停止完成 其停止后可能设置了重启
+	s.waitStopping()
+	s.stopRestartTimer()
+}
+
+// stopProcess 停止进程 等待退出期间释放锁 调用方需持有锁
+func (s *Supervisor) stopProcess(err error) {
 	if s.processRunning {
 		s.reportStatus(StoppingStatus, nil)
-		s.process.Kill()
+		// 先停止探针等协程
+		s.procCancelFunc()
+		proc, tail := s.process, s.outputTail
 		s.processRunning = false
 		s.process = nil
-		s.procCancelFunc()
-		s.reportStatus(StoppedStatus, nil)
+		s.outputTail = nil
+		duration := s.terminateUnlocked(proc)
+		s.reportStopped(KilledStopReason, err, duration, proc, tail)
+	}
+}
+
+// fetchArtifactUnlocked 释放锁下载artifact 期间被kill reload或关闭时返回false 放弃本次启动 调用方需持有锁
+// 下载前先占用目标版本 放弃启动或下载失败时释放
+func (s *Supervisor) fetchArtifactUnlocked() (bool, error) {
+	seq := s.killSeq
+	y := s.opts.Yaml
+	if err := s.stageRelease(&y); err != nil {
+		return false, err
+	}
+	s.locker.Unlock()
+	err := fetchArtifact(y.Workdir, y.Artifact)
+	s.locker.Lock()
+	if s.killSeq != seq || !s.isRunning || s.processRunning {
+		s.unstageRelease()
+		return false, nil
+	}
+	if err != nil {
+		s.unstageRelease()
 	}
+	return err == nil, err
+}
+
+// terminateUnlocked 释放锁等待进程退出 期间不会启动新进程 调用方需持有锁
+func (s *Supervisor) terminateUnlocked(proc *Process) time.Duration {
+	y := s.opts.Yaml
+	s.stopping += 1
+	s.locker.Unlock()
+	duration := s.terminateProcess(proc, y)
+	s.locker.Lock()
+	s.stopping -= 1
+	s.stopCond.Broadcast()
+	return duration
+}
+
+// waitStopping 等待正在停止的进程退出 调用方需持有锁
+func (s *Supervisor) waitStopping() {
+	for s.stopping > 0 {
+		s.stopCond.Wait()
+	}
+}
+
+// terminateProcess 执行preStop 发送停止信号并等待整个进程组退出 超时后强制杀死
+func (s *Supervisor) terminateProcess(proc *Process, y Yaml) time.Duration {
+	cfg := y.Stop
+	beginTime := time.Now()
+	timeout := cfg.GetTimeout()
+	if cfg != nil && cfg.PreStop != "" {
+		output := newLineWriter("preStop", s.logger)
+		// preStop以服务的运行用户执行
+		opts, err := y.credentialOptions()
+		var preStop *Process
+		if err == nil {
+			preStop, err = RunProcess(
+				s.runDir(&y),
+				cfg.PreStop,
+				s.processEnvs(&y),
+				nil,
+				output,
+				output,
+				opts...,
+			)
+		}
+		if err == nil {
+			select {
+			case <-preStop.Done():
+				err = preStop.Wait()
+			case <-time.After(timeout):
+				err = fmt.Errorf("preStop timeout: %v", timeout)
+				preStop.Terminate(syscall.SIGKILL, time.Second)
+			}
+		}
+		output.Flush()
+		if err != nil {
+			log.Printf("%s run preStop failed with err: %v", s.opts.ServiceId, err)
+		}
+	}
+	remaining := timeout - time.Since(beginTime)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+	err := proc.Terminate(cfg.getSignal(), remaining)
+	// 等待进程被回收 以便获取退出信息
+	select {
+	case <-proc.Done():
+	case <-time.After(time.Second):
+	}
+	duration := time.Since(beginTime)
+	if err != nil {
+		log.Printf("%s terminate process failed with err: %v", s.opts.ServiceId, err)
+	}
+	log.Printf("%s process stopped in %v", s.opts.ServiceId, duration)
+	return duration
 }
 
 func (s *Supervisor) RestartProcess() error {
-	err := s.KillProcess()
-	if err == nil {
-		return s.startProcess()
+	s.opLocker.Lock()
+	defer s.opLocker.Unlock()
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if !s.isRunning {
+		return errors.New("supervisor closed")
 	}
-	return err
+	s.killProcess()
+	return s.startProcessLocked()
 }
 
 func (s *Supervisor) Shutdown() error {
+	s.opLocker.Lock()
+	defer s.opLocker.Unlock()
 	s.locker.Lock()
 	defer s.locker.Unlock()
 	if !s.isRunning {
 		return errors.New("supervisor closed")
 	}
-	s.killProcess()
+	// 先标记关闭 停止期间不再启动新进程
 	s.isRunning = false
+	s.killProcess()
 	if s.supvCancelFunc != nil {
 		s.supvCancelFunc()
 	}
+	s.stopControlServer()
+	if s.logger != nil {
+		s.logger.Close()
+	}
+	if s.cgroup != nil {
+		if err := s.cgroup.remove(); err != nil {
+			log.Printf("%s remove cgroup failed with err: %v", s.opts.ServiceId, err)
+		}
+	}
 	return nil
 }
 
+// runHealthCheck 检查zallet是否可用 zallet重启或升级时不影响服务运行
 func (s *Supervisor) runHealthCheck(ctx context.Context) {
 	var failed int64 = 0
 	for ctx.Err() == nil {
 		if s.healthCheck() {
+			if failed > 3 {
+				log.Println("zallet is back, flush pending status reports")
+			}
 			failed = 0
+			s.reportLocker.Lock()
+			s.flushPendingReports()
+			s.reportLocker.Unlock()
 		} else {
 			failed += 1
+			if failed == 4 {
+				log.Println("health check failed!!buffer status reports until zallet is back")
+			}
 		}
-		if failed > 3 {
-			log.Println("health check failed!!shutdown supervisor")
-			// 关闭整个supervisor
-			s.ShutdownChan <- struct{}{}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+func (s *Supervisor) runReadiness(ctx context.Context, y Yaml) {
+	probe := y.Readiness
+	delay := probe.getDelay(0)
+	interval := probe.getInterval()
+	timeout := y.GetStartupTimeout()
+	successThreshold := probe.getSuccessThreshold()
+	log.Printf("%s run readiness probe delay: %v interval: %v startupTimeout: %v", s.opts.ServiceId, delay, interval, timeout)
+	deadline := time.Now().Add(timeout)
+	if !sleepCtx(ctx, delay) {
+		return
+	}
+	// exec探针以服务的运行用户执行 解析失败时探针视为失败
+	opts, optsErr := y.credentialOptions()
+	if optsErr != nil {
+		log.Printf("%s probe credential failed with err: %v", s.opts.ServiceId, optsErr)
+	}
+	failed, succeeded := 0, 0
+	for {
+		result := optsErr == nil && probe.run(s.runDir(&y), s.processEnvs(&y), opts)
+		if result {
+			failed = 0
+			succeeded += 1
+		} else {
+			failed += 1
+			succeeded = 0
+		}
+		s.recordProbe("readiness", probe, result, failed, succeeded)
+		s.locker.Lock()
+		if ctx.Err() != nil {
+			s.locker.Unlock()
+			return
+		}
+		if succeeded >= successThreshold {
+			s.markReady(ctx)
+			s.locker.Unlock()
+			return
+		}
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("readiness probe not passed in startupTimeout: %v", timeout)
+			log.Printf("%s %v", s.opts.ServiceId, err)
+			s.stopProcess(err)
+			s.scheduleRestart(err)
+			s.locker.Unlock()
+			return
+		}
+		s.locker.Unlock()
+		if !sleepCtx(ctx, interval) {
 			return
 		}
-		time.Sleep(3 * time.Second)
 	}
 }
 
-func (s *Supervisor) runProbe(ctx context.Context) {
-	var failed int64 = 0
-	delay, err := time.ParseDuration(s.opts.Yaml.Probe.Delay)
-	if err != nil || delay < time.Second {
-		delay = 10 * time.Second
+func (s *Supervisor) runLiveness(ctx context.Context, probe *Probe, y Yaml) {
+	delay := probe.getDelay(10 * time.Second)
+	interval := probe.getInterval()
+	failureThreshold := probe.getFailureThreshold()
+	successThreshold := probe.getSuccessThreshold()
+	log.Printf("%s run liveness probe delay: %v interval: %v", s.opts.ServiceId, delay, interval)
+	if !sleepCtx(ctx, delay) {
+		return
 	}
-	interval, err := time.ParseDuration(s.opts.Yaml.Probe.Interval)
-	if err != nil || interval < time.Second {
-		interval = 5 * time.Second
+	// exec探针以服务的运行用户执行 解析失败时探针视为失败
+	opts, optsErr := y.credentialOptions()
+	if optsErr != nil {
+		log.Printf("%s probe credential failed with err: %v", s.opts.ServiceId, optsErr)
 	}
-	log.Printf("%s run probe delay: %v interval: %v", s.opts.ServiceId, s.opts.Yaml.Probe.Delay, s.opts.Yaml.Probe.Interval)
-	time.Sleep(delay)
-	for ctx.Err() == nil {
-		if s.opts.Yaml.Probe.run() {
+	failed, succeeded := 0, 0
+	for {
+		result := optsErr == nil && probe.run(s.runDir(&y), s.processEnvs(&y), opts)
+		if result {
 			failed = 0
+			succeeded += 1
 		} else {
 			failed += 1
+			succeeded = 0
+		}
+		s.recordProbe("liveness", probe, result, failed, succeeded)
+		if ctx.Err() != nil {
+			return
 		}
-		if failed > 0 && failed%3 == 0 {
+		if failed >= failureThreshold {
 			// 重启服务
+			log.Printf("%s liveness probe failed %d times, restart process", s.opts.ServiceId, failed)
 			s.RestartProcess()
-			failed = 0
+			return
 		}
-		time.Sleep(interval)
+		s.locker.Lock()
+		if ctx.Err() == nil {
+			if failed > 0 && s.status != UnhealthyStatus {
+				s.reportStatus(UnhealthyStatus, fmt.Errorf("liveness probe failed %d times", failed))
+			} else if succeeded >= successThreshold && s.status == UnhealthyStatus {
+				s.reportStatus(RunningStatus, nil)
+			}
+		}
+		s.locker.Unlock()
+		if !sleepCtx(ctx, interval) {
+			return
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
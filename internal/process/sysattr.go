@@ -0,0 +1,162 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+const (
+	unlimited = "unlimited"
+	// ExecCmdName 设置进程属性后exec原命令的zallet子命令
+	ExecCmdName = "exec"
+)
+
+// execAttr 需在exec前由子进程自身设置的属性
+type execAttr struct {
+	Rlimits     []execRlimit `json:"rlimits,omitempty"`
+	OomScoreAdj *int         `json:"oomScoreAdj,omitempty"`
+	// Uid 不为空时设置完其他属性后切换用户
+	Uid    *uint32  `json:"uid,omitempty"`
+	Gid    uint32   `json:"gid,omitempty"`
+	Groups []uint32 `json:"groups,omitempty"`
+}
+
+type execRlimit struct {
+	Resource int    `json:"resource"`
+	Cur      uint64 `json:"cur"`
+	Max      uint64 `json:"max"`
+}
+
+type UlimitCfg struct {
+	// 取值为 数字 unlimited 或 soft:hard
+	Nofile string `json:"nofile,omitempty" yaml:"nofile,omitempty"`
+	Nproc  string `json:"nproc,omitempty" yaml:"nproc,omitempty"`
+	Core   string `json:"core,omitempty" yaml:"core,omitempty"`
+}
+
+func (c *UlimitCfg) IsValid() error {
+	for name, limit := range map[string]string{
+		"nofile": c.Nofile,
+		"nproc":  c.Nproc,
+		"core":   c.Core,
+	} {
+		if limit == "" {
+			continue
+		}
+		if _, _, err := parseUlimit(limit); err != nil {
+			return fmt.Errorf("invalid ulimit %s: %s", name, limit)
+		}
+	}
+	return nil
+}
+
+func parseUlimitValue(value string) (uint64, error) {
+	if value == unlimited {
+		return ^uint64(0), nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// parseUlimit 解析 soft:hard 只有一个值时soft和hard相同
+func parseUlimit(limit string) (uint64, uint64, error) {
+	softStr, hardStr, b := strings.Cut(strings.TrimSpace(limit), ":")
+	soft, err := parseUlimitValue(softStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !b {
+		return soft, soft, nil
+	}
+	hard, err := parseUlimitValue(hardStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if soft > hard {
+		return 0, 0, errors.New("soft limit is greater than hard limit")
+	}
+	return soft, hard, nil
+}
+
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupId(name)
+	}
+	return user.Lookup(name)
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return user.LookupGroupId(name)
+	}
+	return user.LookupGroup(name)
+}
+
+// credential 运行用户和用户组 未配置用户时返回nil
+type credential struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+}
+
+func (f *Yaml) resolveCredential() (*credential, error) {
+	if f.User == "" && f.Group == "" && len(f.SupplementaryGroups) == 0 {
+		return nil, nil
+	}
+	if f.User == "" {
+		return nil, errors.New("group should be used with user")
+	}
+	u, err := lookupUser(f.User)
+	if err != nil {
+		return nil, fmt.Errorf("unknown user: %s", f.User)
+	}
+	gidStr := u.Gid
+	if f.Group != "" {
+		g, err := lookupGroup(f.Group)
+		if err != nil {
+			return nil, fmt.Errorf("unknown group: %s", f.Group)
+		}
+		gidStr = g.Gid
+	}
+	uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(gidStr, 10, 32)
+	ret := &credential{
+		uid:    uint32(uid),
+		gid:    uint32(gid),
+		groups: make([]uint32, 0, len(f.SupplementaryGroups)),
+	}
+	for _, name := range f.SupplementaryGroups {
+		g, err := lookupGroup(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown group: %s", name)
+		}
+		id, _ := strconv.ParseUint(g.Gid, 10, 32)
+		ret.groups = append(ret.groups, uint32(id))
+	}
+	return ret, nil
+}
+
+func (f *Yaml) isSysAttrValid() error {
+	if _, err := f.resolveCredential(); err != nil {
+		return err
+	}
+	if f.Ulimits != nil {
+		if err := f.Ulimits.IsValid(); err != nil {
+			return err
+		}
+	}
+	if f.Nice < -20 || f.Nice > 19 {
+		return fmt.Errorf("invalid nice: %d", f.Nice)
+	}
+	for _, cpu := range f.CpuAffinity {
+		if cpu < 0 || cpu >= cpuSetSize {
+			return fmt.Errorf("invalid cpuAffinity: %d", cpu)
+		}
+	}
+	if f.OomScoreAdj != nil && (*f.OomScoreAdj < -1000 || *f.OomScoreAdj > 1000) {
+		return fmt.Errorf("invalid oomScoreAdj: %d", *f.OomScoreAdj)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	cpuSetSize = 1024
+	// syscall包未定义RLIMIT_NPROC
+	rlimitNproc = 0x6
+)
+
+// sysAttrOptions 运行用户 ulimit nice cpu亲和性 oom分数
+// nice和cpu亲和性在fork前设置到锁定的线程 由子进程继承
+// ulimit和oom分数需在exec前设置 通过zallet exec在子进程中设置后切换用户再exec原命令
+func (f *Yaml) sysAttrOptions() ([]CmdOption, error) {
+	attr := execAttr{
+		OomScoreAdj: f.OomScoreAdj,
+	}
+	if f.Ulimits != nil {
+		for resource, limit := range map[int]string{
+			syscall.RLIMIT_NOFILE: f.Ulimits.Nofile,
+			rlimitNproc:           f.Ulimits.Nproc,
+			syscall.RLIMIT_CORE:   f.Ulimits.Core,
+		} {
+			if limit == "" {
+				continue
+			}
+			soft, hard, err := parseUlimit(limit)
+			if err != nil {
+				return nil, err
+			}
+			attr.Rlimits = append(attr.Rlimits, execRlimit{
+				Resource: resource,
+				Cur:      soft,
+				Max:      hard,
+			})
+		}
+	}
+	ret := make([]CmdOption, 0)
+	if f.Nice != 0 {
+		nice := f.Nice
+		ret = append(ret, func(*exec.Cmd) (func(int) error, error) {
+			// linux下nice值是线程级别的 当前线程已锁定 无需恢复
+			return nil, syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice)
+		})
+	}
+	if len(f.CpuAffinity) > 0 {
+		cpus := f.CpuAffinity
+		ret = append(ret, func(*exec.Cmd) (func(int) error, error) {
+			return nil, setCpuAffinity(cpus)
+		})
+	}
+	if len(attr.Rlimits) == 0 && attr.OomScoreAdj == nil {
+		credOpts, err := f.credentialOptions()
+		if err != nil {
+			return nil, err
+		}
+		return append(ret, credOpts...), nil
+	}
+	// 提高hard limit和降低oom分数需要权限 由zallet exec设置后再切换用户
+	cred, err := f.resolveCredential()
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		attr.Uid = &cred.uid
+		attr.Gid = cred.gid
+		attr.Groups = cred.groups
+	}
+	return append(ret, execAttrOption(attr)), nil
+}
+
+// credentialOptions 运行用户和用户组 探针和preStop也以该用户执行
+func (f *Yaml) credentialOptions() ([]CmdOption, error) {
+	ret := make([]CmdOption, 0)
+	cred, err := f.resolveCredential()
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		ret = append(ret, func(cmd *exec.Cmd) (func(int) error, error) {
+			if cmd.SysProcAttr == nil {
+				cmd.SysProcAttr = &syscall.SysProcAttr{}
+			}
+			cmd.SysProcAttr.Credential = &syscall.Credential{
+				Uid:    cred.uid,
+				Gid:    cred.gid,
+				Groups: cred.groups,
+			}
+			return nil, nil
+		})
+	}
+	return ret, nil
+}
+
+// setCpuAffinity 设置当前线程的cpu亲和性
+func setCpuAffinity(cpus []int) error {
+	var mask [cpuSetSize / 64]uint64
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << (uint(cpu) % 64)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return fmt.Errorf("sched_setaffinity failed with err: %v", errno)
+	}
+	return nil
+}
+
+// execAttrOption 将命令改为通过zallet exec执行 pid不变
+func execAttrOption(attr execAttr) CmdOption {
+	return func(cmd *exec.Cmd) (func(int) error, error) {
+		m, err := json.Marshal(attr)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Args = append([]string{os.Args[0], ExecCmdName, string(m), cmd.Path}, cmd.Args...)
+		// zallet升级后原文件可能已被替换 /proc/self/exe仍指向supervisor自身的可执行文件
+		cmd.Path = "/proc/self/exe"
+		return nil, nil
+	}
+}
+
+// ExecWithAttr zallet exec的实现 args为属性 命令路径和原命令参数
+// 依次设置ulimit oom分数和运行用户 再exec原命令 属性会被启动脚本fork出的所有进程继承
+func ExecWithAttr(args []string) error {
+	if len(args) < 3 {
+		return errors.New("invalid exec args")
+	}
+	var attr execAttr
+	if err := json.Unmarshal([]byte(args[0]), &attr); err != nil {
+		return err
+	}
+	for _, limit := range attr.Rlimits {
+		err := syscall.Setrlimit(limit.Resource, &syscall.Rlimit{
+			Cur: limit.Cur,
+			Max: limit.Max,
+		})
+		if err != nil {
+			return fmt.Errorf("setrlimit %d failed with err: %v", limit.Resource, err)
+		}
+	}
+	if attr.OomScoreAdj != nil {
+		err := os.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(*attr.OomScoreAdj)), 0o644)
+		if err != nil {
+			return fmt.Errorf("write oom_score_adj failed with err: %v", err)
+		}
+	}
+	if attr.Uid != nil {
+		groups := make([]int, 0, len(attr.Groups))
+		for _, g := range attr.Groups {
+			groups = append(groups, int(g))
+		}
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("setgroups failed with err: %v", err)
+		}
+		if err := syscall.Setgid(int(attr.Gid)); err != nil {
+			return fmt.Errorf("setgid failed with err: %v", err)
+		}
+		if err := syscall.Setuid(int(*attr.Uid)); err != nil {
+			return fmt.Errorf("setuid failed with err: %v", err)
+		}
+	}
+	return syscall.Exec(args[1], args[2:], os.Environ())
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package process
+
+import "errors"
+
+const cpuSetSize = 1024
+
+func (f *Yaml) sysAttrOptions() ([]CmdOption, error) {
+	if f.User != "" || f.Ulimits != nil || f.Nice != 0 || len(f.CpuAffinity) > 0 || f.OomScoreAdj != nil {
+		return nil, errors.New("process attributes are only supported on linux")
+	}
+	return nil, nil
+}
+
+func (f *Yaml) credentialOptions() ([]CmdOption, error) {
+	if f.User != "" {
+		return nil, errors.New("process attributes are only supported on linux")
+	}
+	return nil, nil
+}
+
+func ExecWithAttr([]string) error {
+	return errors.New("process attributes are only supported on linux")
+}
@@ -0,0 +1,92 @@
+package process
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// tailBuffer 只保留最后size字节的环形缓存
+type tailBuffer struct {
+	sync.Mutex
+	buf  []byte
+	size int
+	pos  int
+	full bool
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{
+		buf:  make([]byte, size),
+		size: size,
+	}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	n := len(p)
+	if n >= b.size {
+		copy(b.buf, p[n-b.size:])
+		b.pos = 0
+		b.full = true
+		return n, nil
+	}
+	c := copy(b.buf[b.pos:], p)
+	if c < n {
+		copy(b.buf, p[c:])
+		b.full = true
+	}
+	b.pos = (b.pos + n) % b.size
+	if b.pos == 0 {
+		b.full = true
+	}
+	return n, nil
+}
+
+func (b *tailBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	if !b.full {
+		return string(b.buf[:b.pos])
+	}
+	ret := make([]byte, 0, b.size)
+	ret = append(ret, b.buf[b.pos:]...)
+	return string(append(ret, b.buf[:b.pos]...))
+}
+
+// ExitInfo 进程退出信息
+type ExitInfo struct {
+	// ExitCode 被信号杀死时为-1
+	ExitCode   int
+	Signal     string
+	CoreDumped bool
+}
+
+// ExitInfo 获取进程退出信息 进程还未被回收时退出码为-1
+func (p *Process) ExitInfo() ExitInfo {
+	select {
+	case <-p.done:
+		return p.exit
+	default:
+		return ExitInfo{
+			ExitCode: -1,
+		}
+	}
+}
+
+func newExitInfo(state *os.ProcessState) ExitInfo {
+	if state == nil {
+		return ExitInfo{
+			ExitCode: -1,
+		}
+	}
+	ret := ExitInfo{
+		ExitCode: state.ExitCode(),
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		ret.Signal = status.Signal().String()
+		ret.CoreDumped = status.CoreDump()
+	}
+	return ret
+}
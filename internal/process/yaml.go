@@ -1,18 +1,56 @@
 package process
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
+	"time"
+)
+
+const (
+	defaultStartupTimeout = 5 * time.Minute
+)
+
+type UpdateStrategy string
+
+const (
+	// RecreateUpdateStrategy 停止旧进程后启动新进程
+	RecreateUpdateStrategy UpdateStrategy = "recreate"
+	// StartFirstUpdateStrategy 新服务就绪后再停止旧服务
+	StartFirstUpdateStrategy UpdateStrategy = "startFirst"
 )
 
 type Yaml struct {
-	Env     string            `json:"env" yaml:"env"`
-	App     string            `json:"app" yaml:"app"`
-	Start   string            `json:"start" yaml:"start"`
-	With    map[string]string `json:"with" yaml:"with"`
-	Probe   *Probe            `json:"probe" yaml:"probe"`
-	Workdir string            `json:"workdir" yaml:"workdir"`
+	Env                 string            `json:"env" yaml:"env"`
+	App                 string            `json:"app" yaml:"app"`
+	Name                string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Start               string            `json:"start" yaml:"start"`
+	With                map[string]string `json:"with" yaml:"with"`
+	Probe               *Probe            `json:"probe" yaml:"probe"`
+	Readiness           *Probe            `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+	Liveness            *Probe            `json:"liveness,omitempty" yaml:"liveness,omitempty"`
+	StartupTimeout      string            `json:"startupTimeout,omitempty" yaml:"startupTimeout,omitempty"`
+	Workdir             string            `json:"workdir" yaml:"workdir"`
+	Log                 *LogCfg           `json:"log,omitempty" yaml:"log,omitempty"`
+	Restart             *RestartCfg       `json:"restart,omitempty" yaml:"restart,omitempty"`
+	Resources           *ResourcesCfg     `json:"resources,omitempty" yaml:"resources,omitempty"`
+	User                string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Group               string            `json:"group,omitempty" yaml:"group,omitempty"`
+	SupplementaryGroups []string          `json:"supplementaryGroups,omitempty" yaml:"supplementaryGroups,omitempty"`
+	Ulimits             *UlimitCfg        `json:"ulimits,omitempty" yaml:"ulimits,omitempty"`
+	Nice                int               `json:"nice,omitempty" yaml:"nice,omitempty"`
+	CpuAffinity         []int             `json:"cpuAffinity,omitempty" yaml:"cpuAffinity,omitempty"`
+	OomScoreAdj         *int              `json:"oomScoreAdj,omitempty" yaml:"oomScoreAdj,omitempty"`
+	Stop                *StopCfg          `json:"stop,omitempty" yaml:"stop,omitempty"`
+	UpdateStrategy      UpdateStrategy    `json:"updateStrategy,omitempty" yaml:"updateStrategy,omitempty"`
+	Replicas            int               `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+	Type                ServiceType       `json:"type,omitempty" yaml:"type,omitempty"`
+	Schedule            string            `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Concurrency         ConcurrencyPolicy `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Artifact            *ArtifactCfg      `json:"artifact,omitempty" yaml:"artifact,omitempty"`
+	Selector            map[string]string `json:"selector,omitempty" yaml:"selector,omitempty"`
 }
 
 func (f *Yaml) IsValid() error {
@@ -23,13 +61,116 @@ func (f *Yaml) IsValid() error {
 	if !noSpacePattern.MatchString(f.App) {
 		return errors.New("invalid app")
 	}
+	if f.Name != "" && !noSpacePattern.MatchString(f.Name) {
+		return errors.New("invalid name")
+	}
 	if f.Start == "" {
 		return errors.New("invalid service")
 	}
 	if f.Workdir == "" {
 		return errors.New("invalid workdir")
 	}
-	return nil
+	for name, probe := range map[string]*Probe{
+		"probe":     f.Probe,
+		"readiness": f.Readiness,
+		"liveness":  f.Liveness,
+	} {
+		if probe != nil && !probe.IsValid() {
+			return fmt.Errorf("invalid %s", name)
+		}
+	}
+	if f.StartupTimeout != "" {
+		if _, err := time.ParseDuration(f.StartupTimeout); err != nil {
+			return errors.New("invalid startupTimeout")
+		}
+	}
+	if f.Restart != nil {
+		if err := f.Restart.IsValid(); err != nil {
+			return err
+		}
+	}
+	if f.Resources != nil {
+		if err := f.Resources.IsValid(); err != nil {
+			return err
+		}
+	}
+	if err := f.isSysAttrValid(); err != nil {
+		return err
+	}
+	if f.Stop != nil {
+		if err := f.Stop.IsValid(); err != nil {
+			return err
+		}
+	}
+	if f.Artifact != nil {
+		if err := f.Artifact.IsValid(); err != nil {
+			return err
+		}
+	}
+	if f.Replicas < 0 {
+		return errors.New("invalid replicas")
+	}
+	switch f.UpdateStrategy {
+	case "", RecreateUpdateStrategy, StartFirstUpdateStrategy:
+	default:
+		return errors.New("invalid updateStrategy")
+	}
+	return f.isTypeValid()
+}
+
+// getLiveness 兼容旧配置 probe等同于liveness
+func (f *Yaml) getLiveness() *Probe {
+	if f.Liveness != nil {
+		return f.Liveness
+	}
+	return f.Probe
+}
+
+// GetStartupTimeout 等待就绪探针通过的最长时间
+func (f *Yaml) GetStartupTimeout() time.Duration {
+	timeout, err := time.ParseDuration(f.StartupTimeout)
+	if err != nil || timeout <= 0 {
+		return defaultStartupTimeout
+	}
+	return timeout
+}
+
+// Key 服务的唯一标识 未指定name时使用app+env
+func (f *Yaml) Key() string {
+	return ServiceKey(f.App, f.Env, f.Name)
+}
+
+func ServiceKey(app, env, name string) string {
+	if name != "" {
+		return name
+	}
+	return app + "/" + env
+}
+
+// GetReplicas 副本数 默认1个
+func (f *Yaml) GetReplicas() int {
+	if f.Replicas <= 0 {
+		return 1
+	}
+	return f.Replicas
+}
+
+// Equal 配置内容是否一致 副本数不影响单个服务 不参与比较
+func (f *Yaml) Equal(other *Yaml) bool {
+	if other == nil {
+		return false
+	}
+	x, y := *f, *other
+	x.Replicas, y.Replicas = 0, 0
+	a, err := json.Marshal(x)
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(y)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
 }
 
 func (f *Yaml) FromDB(content []byte) error {
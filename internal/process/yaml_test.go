@@ -0,0 +1,90 @@
+package process
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYamlIsValid(t *testing.T) {
+	intPtr := func(i int) *int {
+		return &i
+	}
+	sha256 := strings.Repeat("a", 64)
+	tests := []struct {
+		name   string
+		mutate func(*Yaml)
+		// expected 错误信息包含的内容 为空时应校验通过
+		expected string
+	}{
+		{"minimal", func(*Yaml) {}, ""},
+		{"name with space", func(y *Yaml) { y.Name = "a b" }, "invalid name"},
+		{"user", func(y *Yaml) { y.User = "root" }, ""},
+		{"user and group by id", func(y *Yaml) { y.User, y.Group = "0", "0" }, ""},
+		{"unknown user", func(y *Yaml) { y.User = "no-such-user-zallet" }, "unknown user"},
+		{"unknown group", func(y *Yaml) { y.User, y.Group = "root", "no-such-group-zallet" }, "unknown group"},
+		{"unknown supplementary group", func(y *Yaml) {
+			y.User, y.SupplementaryGroups = "root", []string{"no-such-group-zallet"}
+		}, "unknown group"},
+		{"group without user", func(y *Yaml) { y.Group = "root" }, "group should be used with user"},
+		{"ulimits", func(y *Yaml) {
+			y.Ulimits = &UlimitCfg{Nofile: "4096:8192", Nproc: "unlimited", Core: "0"}
+		}, ""},
+		{"ulimit soft greater than hard", func(y *Yaml) { y.Ulimits = &UlimitCfg{Nofile: "8192:4096"} }, "invalid ulimit nofile"},
+		{"ulimit not a number", func(y *Yaml) { y.Ulimits = &UlimitCfg{Core: "big"} }, "invalid ulimit core"},
+		{"nice", func(y *Yaml) { y.Nice = -20 }, ""},
+		{"nice out of range", func(y *Yaml) { y.Nice = 20 }, "invalid nice"},
+		{"cpuAffinity", func(y *Yaml) { y.CpuAffinity = []int{0, 1} }, ""},
+		{"negative cpuAffinity", func(y *Yaml) { y.CpuAffinity = []int{-1} }, "invalid cpuAffinity"},
+		{"cpuAffinity out of range", func(y *Yaml) { y.CpuAffinity = []int{cpuSetSize} }, "invalid cpuAffinity"},
+		{"oomScoreAdj", func(y *Yaml) { y.OomScoreAdj = intPtr(-1000) }, ""},
+		{"oomScoreAdj out of range", func(y *Yaml) { y.OomScoreAdj = intPtr(1001) }, "invalid oomScoreAdj"},
+		{"replicas", func(y *Yaml) { y.Replicas = 3 }, ""},
+		{"negative replicas", func(y *Yaml) { y.Replicas = -1 }, "invalid replicas"},
+		{"updateStrategy", func(y *Yaml) { y.UpdateStrategy = StartFirstUpdateStrategy }, ""},
+		{"unknown updateStrategy", func(y *Yaml) { y.UpdateStrategy = "rolling" }, "invalid updateStrategy"},
+		{"artifact", func(y *Yaml) {
+			y.Artifact = &ArtifactCfg{Url: "http://localhost/a.tar.gz", Sha256: sha256, Format: TarGzArtifactFormat}
+		}, ""},
+		{"artifact without url", func(y *Yaml) {
+			y.Artifact = &ArtifactCfg{Sha256: sha256, Format: TarGzArtifactFormat}
+		}, "invalid artifact url"},
+		{"artifact bad sha256", func(y *Yaml) {
+			y.Artifact = &ArtifactCfg{Url: "a.zip", Sha256: "abc", Format: ZipArtifactFormat}
+		}, "invalid artifact sha256"},
+		{"artifact unknown format", func(y *Yaml) {
+			y.Artifact = &ArtifactCfg{Url: "a.rar", Sha256: sha256, Format: "rar"}
+		}, "invalid artifact format"},
+		{"artifact negative keep", func(y *Yaml) {
+			y.Artifact = &ArtifactCfg{Url: "a.zip", Sha256: sha256, Format: ZipArtifactFormat, Keep: -1}
+		}, "invalid artifact keep"},
+		{"job", func(y *Yaml) { y.Type = JobServiceType }, ""},
+		{"cron", func(y *Yaml) { y.Type, y.Schedule = CronServiceType, "*/5 * * * *" }, ""},
+		{"cron descriptor", func(y *Yaml) { y.Type, y.Schedule = CronServiceType, "@daily" }, ""},
+		{"cron without schedule", func(y *Yaml) { y.Type = CronServiceType }, "invalid schedule"},
+		{"schedule without cron", func(y *Yaml) { y.Schedule = "@daily" }, "schedule is only for cron"},
+		{"unknown type", func(y *Yaml) { y.Type = "daemon" }, "invalid type"},
+		{"concurrency", func(y *Yaml) {
+			y.Type, y.Schedule, y.Concurrency = CronServiceType, "@hourly", AllowConcurrencyPolicy
+		}, ""},
+		{"unknown concurrency", func(y *Yaml) { y.Concurrency = "replace" }, "invalid concurrency"},
+	}
+	for _, tt := range tests {
+		y := &Yaml{
+			App:     "app",
+			Env:     "dev",
+			Workdir: "/tmp",
+			Start:   "sleep 1",
+		}
+		tt.mutate(y)
+		err := y.IsValid()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: IsValid() = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: IsValid() = %v, want error containing %q", tt.name, err, tt.expected)
+		}
+	}
+}
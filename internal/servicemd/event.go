@@ -0,0 +1,76 @@
+package servicemd
+
+import (
+	"time"
+	"xorm.io/xorm"
+)
+
+// ServiceEvent 服务状态变化记录
+type ServiceEvent struct {
+	Id         int64     `json:"id" xorm:"pk autoincr"`
+	ServiceId  string    `json:"serviceId"`
+	InstanceId string    `json:"instanceId"`
+	App        string    `json:"app"`
+	Env        string    `json:"env"`
+	Status     string    `json:"status"`
+	ErrLog     string    `json:"errLog" xorm:"text"`
+	CpuPercent int       `json:"cpuPercent"`
+	MemPercent int       `json:"memPercent"`
+	Pid        int       `json:"pid"`
+	ProcessPid int       `json:"processPid"`
+	StopReason string    `json:"stopReason"`
+	ExitCode   int       `json:"exitCode"`
+	ExitSignal string    `json:"signal"`
+	EventTime  int64     `json:"eventTime"`
+	Created    time.Time `json:"created" xorm:"created"`
+}
+
+func (*ServiceEvent) TableName() string {
+	return "zallet_service_event"
+}
+
+func insertServiceEvent(session *xorm.Session, event *ServiceEvent) error {
+	_, err := session.Insert(event)
+	return err
+}
+
+// deleteServiceEventBefore 删除eventTime早于指定时间的事件
+func deleteServiceEventBefore(session *xorm.Session, eventTime int64) (int64, error) {
+	return session.
+		Where("event_time < ?", eventTime).
+		Delete(new(ServiceEvent))
+}
+
+type ListServiceEventReq struct {
+	ServiceId  string
+	App        string
+	InstanceId string
+	// Since 毫秒时间戳 为0不过滤
+	Since int64
+	// AfterId 只返回id更大的记录 用于持续查询
+	AfterId int64
+	Limit   int
+}
+
+// listServiceEvent 按id升序返回事件
+func listServiceEvent(session *xorm.Session, req ListServiceEventReq) ([]ServiceEvent, error) {
+	session.Where("id > ?", req.AfterId)
+	if req.ServiceId != "" {
+		session.And("service_id = ?", req.ServiceId)
+	}
+	if req.App != "" {
+		session.And("app = ?", req.App)
+	}
+	if req.InstanceId != "" {
+		session.And("instance_id = ?", req.InstanceId)
+	}
+	if req.Since > 0 {
+		session.And("event_time >= ?", req.Since)
+	}
+	if req.Limit > 0 {
+		session.Limit(req.Limit)
+	}
+	ret := make([]ServiceEvent, 0)
+	err := session.Asc("id").Find(&ret)
+	return ret, err
+}
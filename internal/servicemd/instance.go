@@ -0,0 +1,54 @@
+package servicemd
+
+import (
+	"time"
+	"xorm.io/xorm"
+)
+
+// Instance zallet实例 每个实例定时上报心跳
+type Instance struct {
+	Id         int64  `json:"id" xorm:"pk autoincr"`
+	InstanceId string `json:"instanceId" xorm:"unique"`
+	LocalIp    string `json:"localIp"`
+	AgentHost  string `json:"agentHost"`
+	Version    string `json:"version"`
+	// StartTime 启动时间 毫秒时间戳
+	StartTime   int64             `json:"startTime"`
+	CpuPercent  int               `json:"cpuPercent"`
+	MemPercent  int               `json:"memPercent"`
+	DiskPercent int               `json:"diskPercent"`
+	Labels      map[string]string `json:"labels" xorm:"text json"`
+	// Heartbeat 最近一次心跳 毫秒时间戳
+	Heartbeat int64     `json:"heartbeat"`
+	Created   time.Time `json:"created" xorm:"created"`
+}
+
+func (*Instance) TableName() string {
+	return "zallet_instance"
+}
+
+// upsertInstance 按instanceId更新 不存在时新增
+func upsertInstance(session *xorm.Session, instance *Instance) error {
+	rows, err := session.
+		Where("instance_id = ?", instance.InstanceId).
+		Cols("local_ip", "agent_host", "version", "start_time", "cpu_percent", "mem_percent", "disk_percent", "labels", "heartbeat").
+		Update(instance)
+	if err != nil || rows > 0 {
+		return err
+	}
+	_, err = session.Insert(instance)
+	return err
+}
+
+func listInstance(session *xorm.Session) ([]Instance, error) {
+	ret := make([]Instance, 0)
+	err := session.Asc("id").Find(&ret)
+	return ret, err
+}
+
+func deleteInstance(session *xorm.Session, instanceId string) (bool, error) {
+	rows, err := session.
+		Where("instance_id = ?", instanceId).
+		Delete(new(Instance))
+	return rows == 1, err
+}
@@ -12,6 +12,9 @@ type Service struct {
 	Pid           int           `json:"pid"`
 	InstanceId    string        `json:"instanceId"`
 	App           string        `json:"app"`
+	Name          string        `json:"name"`
+	ReplicaIndex  int           `json:"replicaIndex"`
+	Source        string        `json:"source"`
 	AppYaml       *process.Yaml `json:"appYaml"`
 	ServiceStatus string        `json:"serviceStatus"`
 	ErrLog        string        `json:"errLog"`
@@ -20,35 +23,89 @@ type Service struct {
 	Env           string        `json:"env"`
 	CpuPercent    int           `json:"cpuPercent"`
 	MemPercent    int           `json:"memPercent"`
+	StopReason    string        `json:"stopReason"`
+	StopDuration  int64         `json:"stopDuration"`
+	ExitCode      int           `json:"exitCode"`
+	ExitSignal    string        `json:"signal"`
+	CoreDumped    bool          `json:"coreDumped"`
+	Runtime       int64         `json:"runtime"`
+	OutputTail    string        `json:"outputTail" xorm:"text"`
+	RestartCount  int           `json:"restartCount"`
+	Action        string        `json:"action"`
 	EventTime     int64         `json:"eventTime"`
+	EventSeq      int64         `json:"eventSeq"`
 	Created       time.Time     `json:"created" xorm:"created"`
 }
 
+const (
+	// GlobalSource 通过apply -global创建 由实例认领
+	GlobalSource = "global"
+	// Action为全局调度的服务等待所在实例执行的操作
+	// ReloadAction 配置已变化 需重新加载
+	ReloadAction = "reload"
+	// DeleteAction 副本数减少 需停止并删除
+	DeleteAction = "delete"
+	// RunAction leader触发的定时任务执行
+	RunAction = "run"
+)
+
 func (*Service) TableName() string {
 	return "zallet_service"
 }
 
-func InsertService(session *xorm.Session, service *Service) error {
+func insertService(session *xorm.Session, service *Service) error {
 	_, err := session.Insert(service)
 	return err
 }
 
-func UpdateServiceStatus(session *xorm.Session, eventTime int64, serviceId string, serviceStatus string, errLog string, cpuPercent, memPercent int) (bool, error) {
+// ServiceExit 最近一次停止时的退出信息
+type ServiceExit struct {
+	ExitCode   int
+	Signal     string
+	CoreDumped bool
+	Runtime    int64
+	OutputTail string
+}
+
+// updateServiceStatus exit不为空时在同一条语句中记录退出信息
+// 只接受更新的上报 event_time相同时按eventSeq判断先后
+func updateServiceStatus(session *xorm.Session, eventTime, eventSeq int64, serviceId string, serviceStatus string, errLog string, cpuPercent, memPercent int, stopReason string, stopDuration int64, exit *ServiceExit) (bool, error) {
+	cols := []string{"service_status", "err_log", "cpu_percent", "mem_percent", "stop_reason", "stop_duration", "event_time", "event_seq"}
+	bean := &Service{
+		ServiceStatus: serviceStatus,
+		ErrLog:        errLog,
+		CpuPercent:    cpuPercent,
+		MemPercent:    memPercent,
+		StopReason:    stopReason,
+		StopDuration:  stopDuration,
+		EventTime:     eventTime,
+		EventSeq:      eventSeq,
+	}
+	if exit != nil {
+		cols = append(cols, "exit_code", "exit_signal", "core_dumped", "runtime", "output_tail")
+		bean.ExitCode = exit.ExitCode
+		bean.ExitSignal = exit.Signal
+		bean.CoreDumped = exit.CoreDumped
+		bean.Runtime = exit.Runtime
+		bean.OutputTail = exit.OutputTail
+	}
 	rows, err := session.
 		Where("service_id = ?", serviceId).
-		And("event_time < ?", eventTime).
-		Cols("service_status", "err_log", "cpu_percent", "mem_percent", "event_time").
-		Update(&Service{
-			ServiceStatus: serviceStatus,
-			ErrLog:        errLog,
-			CpuPercent:    cpuPercent,
-			MemPercent:    memPercent,
-			EventTime:     eventTime,
-		})
+		And("event_time < ? OR (event_time = ? AND event_seq < ?)", eventTime, eventTime, eventSeq).
+		Cols(cols...).
+		Update(bean)
 	return rows == 1, err
 }
 
-func GetServiceByServiceIdAndInstanceId(session *xorm.Session, serviceId, instanceId string) (Service, bool, error) {
+func getServiceByServiceId(session *xorm.Session, serviceId string) (Service, bool, error) {
+	var ret Service
+	b, err := session.
+		Where("service_id = ?", serviceId).
+		Get(&ret)
+	return ret, b, err
+}
+
+func getServiceByServiceIdAndInstanceId(session *xorm.Session, serviceId, instanceId string) (Service, bool, error) {
 	var ret Service
 	b, err := session.
 		Where("service_id = ?", serviceId).
@@ -57,9 +114,132 @@ func GetServiceByServiceIdAndInstanceId(session *xorm.Session, serviceId, instan
 	return ret, b, err
 }
 
-func DeleteServiceByServiceId(session *xorm.Session, serviceId string) (bool, error) {
+// listService instanceId为空时查询所有实例 app和status为空时不过滤 按创建时间倒序
+func listService(session *xorm.Session, instanceId, app, status string) ([]Service, error) {
+	if instanceId != "" {
+		session.Where("instance_id = ?", instanceId)
+	}
+	if app != "" {
+		session.And("app = ?", app)
+	}
+	if status != "" {
+		session.And("service_status = ?", status)
+	}
+	ret := make([]Service, 0)
+	err := session.Desc("created").Find(&ret)
+	return ret, err
+}
+
+func deleteServiceByServiceId(session *xorm.Session, serviceId string) (bool, error) {
 	rows, err := session.
 		Where("service_id = ?", serviceId).
 		Delete(new(Service))
 	return rows == 1, err
 }
+
+// listServiceByKey 按name查找 name为空时按app+env查找 不包含全局调度的服务
+func listServiceByKey(session *xorm.Session, instanceId, app, env, name string) ([]Service, error) {
+	session.Where("instance_id = ?", instanceId)
+	if name != "" {
+		session.And("name = ?", name)
+	} else {
+		session.
+			And("app = ?", app).
+			And("env = ?", env).
+			And("name = ?", "")
+	}
+	session.And("source <> ?", GlobalSource)
+	ret := make([]Service, 0)
+	err := session.Asc("id").Find(&ret)
+	return ret, err
+}
+
+// updateServiceSourceByKey 记录服务来源 用于清理来源中已删除的服务
+func updateServiceSourceByKey(session *xorm.Session, instanceId, app, env, name, source string) (int64, error) {
+	session.Where("instance_id = ?", instanceId)
+	if name != "" {
+		session.And("name = ?", name)
+	} else {
+		session.
+			And("app = ?", app).
+			And("env = ?", env).
+			And("name = ?", "")
+	}
+	session.And("source <> ?", GlobalSource)
+	return session.
+		Cols("source").
+		Update(&Service{
+			Source: source,
+		})
+}
+
+func listServiceBySource(session *xorm.Session, instanceId, source string) ([]Service, error) {
+	ret := make([]Service, 0)
+	err := session.
+		Where("instance_id = ?", instanceId).
+		And("source = ?", source).
+		Asc("id").
+		Find(&ret)
+	return ret, err
+}
+
+// markServiceLost 所在实例长时间停止心跳时标记为停止 不修改eventTime 实例恢复后supervisor仍可上报状态
+func markServiceLost(session *xorm.Session, serviceId, stopReason string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		Cols("service_status", "stop_reason", "cpu_percent", "mem_percent").
+		Update(&Service{
+			ServiceStatus: string(process.StoppedStatus),
+			StopReason:    stopReason,
+		})
+	return rows == 1, err
+}
+
+func listServiceByInstanceId(session *xorm.Session, instanceId string) ([]Service, error) {
+	ret := make([]Service, 0)
+	err := session.
+		Where("instance_id = ?", instanceId).
+		Find(&ret)
+	return ret, err
+}
+
+// updateServicePid pid不受event_time限制总是更新 supervisor的首次上报可能先于此提交
+// 状态只在没有更新的上报时改为serviceStatus 返回服务是否存在
+func updateServicePid(session *xorm.Session, eventTime int64, serviceId string, pid int, serviceStatus string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		Cols("pid").
+		Update(&Service{
+			Pid: pid,
+		})
+	if err != nil || rows == 0 {
+		return false, err
+	}
+	_, err = session.
+		Where("service_id = ?", serviceId).
+		And("event_time < ?", eventTime).
+		Cols("service_status", "err_log", "stop_reason", "event_time").
+		Update(&Service{
+			ServiceStatus: serviceStatus,
+			EventTime:     eventTime,
+		})
+	return true, err
+}
+
+func incrServiceRestartCount(session *xorm.Session, serviceId string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		Incr("restart_count").
+		Update(new(Service))
+	return rows == 1, err
+}
+
+func updateServiceAppYaml(session *xorm.Session, serviceId string, appYaml *process.Yaml) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		Cols("app_yaml").
+		Update(&Service{
+			AppYaml: appYaml,
+		})
+	return rows == 1, err
+}
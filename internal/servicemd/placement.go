@@ -0,0 +1,153 @@
+package servicemd
+
+import (
+	"github.com/LeeZXin/zallet/internal/process"
+	"xorm.io/xorm"
+)
+
+// listGlobalServiceByKey 全局调度的服务 不包含等待删除的 按副本序号升序
+func listGlobalServiceByKey(session *xorm.Session, app, env, name string) ([]Service, error) {
+	session.
+		Where("source = ?", GlobalSource).
+		And("action <> ?", DeleteAction)
+	if name != "" {
+		session.And("name = ?", name)
+	} else {
+		session.
+			And("app = ?", app).
+			And("env = ?", env).
+			And("name = ?", "")
+	}
+	ret := make([]Service, 0)
+	err := session.Asc("replica_index", "id").Find(&ret)
+	return ret, err
+}
+
+// listGlobalService 所有全局调度的服务 不包含等待删除的
+func listGlobalService(session *xorm.Session) ([]Service, error) {
+	ret := make([]Service, 0)
+	err := session.
+		Where("source = ?", GlobalSource).
+		And("action <> ?", DeleteAction).
+		Asc("replica_index", "id").
+		Find(&ret)
+	return ret, err
+}
+
+// listPendingService 等待认领的服务
+func listPendingService(session *xorm.Session) ([]Service, error) {
+	ret := make([]Service, 0)
+	err := session.
+		Where("source = ?", GlobalSource).
+		And("instance_id = ?", "").
+		Asc("id").
+		Find(&ret)
+	return ret, err
+}
+
+// listClaimedService 已被认领的全局调度服务
+func listClaimedService(session *xorm.Session) ([]Service, error) {
+	ret := make([]Service, 0)
+	err := session.
+		Where("source = ?", GlobalSource).
+		And("instance_id <> ?", "").
+		Asc("id").
+		Find(&ret)
+	return ret, err
+}
+
+// listServiceWithAction 本实例有待执行操作的服务
+func listServiceWithAction(session *xorm.Session, instanceId string) ([]Service, error) {
+	ret := make([]Service, 0)
+	err := session.
+		Where("instance_id = ?", instanceId).
+		And("source = ?", GlobalSource).
+		And("action <> ?", "").
+		Asc("id").
+		Find(&ret)
+	return ret, err
+}
+
+// claimService 只有未被认领时才能更新成功 多个实例同时认领时只有一个成功
+func claimService(session *xorm.Session, eventTime int64, serviceId, instanceId, agentHost, agentToken string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		And("instance_id = ?", "").
+		Cols("instance_id", "agent_host", "agent_token", "service_status", "event_time").
+		Update(&Service{
+			InstanceId:    instanceId,
+			AgentHost:     agentHost,
+			AgentToken:    agentToken,
+			ServiceStatus: string(process.StartingStatus),
+			EventTime:     eventTime,
+		})
+	return rows == 1, err
+}
+
+// releaseService 释放原实例认领的服务 等待重新认领
+// 不同实例的时钟可能不一致 重置event_time
+func releaseService(session *xorm.Session, serviceId, instanceId string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		And("instance_id = ?", instanceId).
+		Cols("instance_id", "pid", "agent_host", "agent_token", "service_status", "action", "event_time", "event_seq").
+		Update(&Service{
+			ServiceStatus: string(process.PendingStatus),
+		})
+	return rows == 1, err
+}
+
+func updateServiceAction(session *xorm.Session, serviceId, action string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		Cols("action").
+		Update(&Service{
+			Action: action,
+		})
+	return rows == 1, err
+}
+
+// markServiceAction 没有待执行的操作时才能标记 避免覆盖reload等操作
+func markServiceAction(session *xorm.Session, serviceId, action string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		And("action = ?", "").
+		Cols("action").
+		Update(&Service{
+			Action: action,
+		})
+	return rows == 1, err
+}
+
+func updateServiceAppYamlAndAction(session *xorm.Session, serviceId string, appYaml *process.Yaml, action string) (bool, error) {
+	rows, err := session.
+		Where("service_id = ?", serviceId).
+		Cols("app_yaml", "action").
+		Update(&Service{
+			AppYaml: appYaml,
+			Action:  action,
+		})
+	return rows == 1, err
+}
+
+// countServiceByInstance 每个实例的服务数
+func countServiceByInstance(session *xorm.Session) (map[string]int, error) {
+	type count struct {
+		InstanceId string
+		Total      int
+	}
+	counts := make([]count, 0)
+	err := session.
+		Table(new(Service)).
+		Select("instance_id, count(1) as total").
+		GroupBy("instance_id").
+		Find(&counts)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]int, len(counts))
+	for _, c := range counts {
+		ret[c.InstanceId] = c.Total
+	}
+	return ret, nil
+}
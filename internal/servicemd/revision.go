@@ -0,0 +1,87 @@
+package servicemd
+
+import (
+	"github.com/LeeZXin/zallet/internal/process"
+	"time"
+	"xorm.io/xorm"
+)
+
+// ServiceRevision 按服务key记录每次生效的配置 有name时按name 否则按app+env
+type ServiceRevision struct {
+	Id         int64         `json:"id" xorm:"pk autoincr"`
+	App        string        `json:"app" xorm:"unique(app_env_name_revision)"`
+	Env        string        `json:"env" xorm:"unique(app_env_name_revision)"`
+	Name       string        `json:"name" xorm:"unique(app_env_name_revision)"`
+	Revision   int           `json:"revision" xorm:"unique(app_env_name_revision)"`
+	AppYaml    *process.Yaml `json:"appYaml"`
+	Note       string        `json:"note"`
+	InstanceId string        `json:"instanceId"`
+	Created    time.Time     `json:"created" xorm:"created"`
+}
+
+func (*ServiceRevision) TableName() string {
+	return "zallet_service_revision"
+}
+
+const insertRevisionRetries = 5
+
+// whereRevisionKey 版本号在同一个服务key下递增 与listServiceByKey的查找方式一致
+func whereRevisionKey(session *xorm.Session, app, env, name string) *xorm.Session {
+	if name != "" {
+		return session.Where("name = ?", name)
+	}
+	return session.
+		Where("app = ?", app).
+		And("env = ?", env).
+		And("name = ?", "")
+}
+
+// insertServiceRevision 并发插入时唯一索引冲突后重新分配版本号
+func insertServiceRevision(session *xorm.Session, revision *ServiceRevision) error {
+	var err error
+	for i := 0; i < insertRevisionRetries; i++ {
+		var last ServiceRevision
+		_, err = whereRevisionKey(session, revision.App, revision.Env, revision.Name).
+			Desc("revision").
+			Get(&last)
+		if err != nil {
+			return err
+		}
+		revision.Id = 0
+		revision.Revision = last.Revision + 1
+		_, err = session.Insert(revision)
+		if err == nil {
+			return nil
+		}
+		// 版本号已被其他请求占用时重试
+		_, exist, err2 := getServiceRevision(session, revision.App, revision.Env, revision.Name, revision.Revision)
+		if err2 != nil || !exist {
+			return err
+		}
+	}
+	return err
+}
+
+func getServiceRevision(session *xorm.Session, app, env, name string, revision int) (ServiceRevision, bool, error) {
+	var ret ServiceRevision
+	b, err := whereRevisionKey(session, app, env, name).
+		And("revision = ?", revision).
+		Get(&ret)
+	return ret, b, err
+}
+
+// listServiceRevision 按给出的条件过滤 app和name至少有一个不为空
+func listServiceRevision(session *xorm.Session, app, env, name string) ([]ServiceRevision, error) {
+	if app != "" {
+		session.And("app = ?", app)
+	}
+	if env != "" {
+		session.And("env = ?", env)
+	}
+	if name != "" {
+		session.And("name = ?", name)
+	}
+	ret := make([]ServiceRevision, 0)
+	err := session.Asc("name", "env", "revision").Find(&ret)
+	return ret, err
+}
@@ -0,0 +1,76 @@
+package servicemd
+
+import (
+	"testing"
+)
+
+func TestInsertServiceRevision(t *testing.T) {
+	store := newTestStore(t)
+	tests := []struct {
+		app, env, name string
+		expected       int
+	}{
+		{"a", "dev", "", 1},
+		{"a", "dev", "", 2},
+		{"a", "prod", "", 1},
+		// 同一app+env下的具名服务单独编号
+		{"a", "dev", "alpha", 1},
+		{"a", "dev", "beta", 1},
+		{"a", "dev", "alpha", 2},
+		{"a", "dev", "", 3},
+	}
+	for i, tt := range tests {
+		revision := &ServiceRevision{
+			App:  tt.app,
+			Env:  tt.env,
+			Name: tt.name,
+		}
+		if err := store.InsertServiceRevision(revision); err != nil {
+			t.Fatalf("#%d: InsertServiceRevision failed with err: %v", i, err)
+		}
+		if revision.Revision != tt.expected {
+			t.Errorf("#%d: %s/%s/%s revision = %d, want %d", i, tt.app, tt.env, tt.name, revision.Revision, tt.expected)
+		}
+	}
+	getTests := []struct {
+		app, env, name string
+		revision       int
+		found          bool
+	}{
+		{"a", "dev", "", 3, true},
+		{"a", "dev", "", 4, false},
+		{"", "", "alpha", 2, true},
+		{"", "", "beta", 2, false},
+		{"a", "prod", "", 2, false},
+	}
+	for _, tt := range getTests {
+		ret, found, err := store.GetServiceRevision(tt.app, tt.env, tt.name, tt.revision)
+		if err != nil {
+			t.Fatalf("GetServiceRevision failed with err: %v", err)
+		}
+		if found != tt.found {
+			t.Errorf("GetServiceRevision(%s/%s/%s, %d) found = %v, want %v", tt.app, tt.env, tt.name, tt.revision, found, tt.found)
+		}
+		if found && (ret.Name != tt.name || ret.Revision != tt.revision) {
+			t.Errorf("GetServiceRevision(%s/%s/%s, %d) = %s/%d", tt.app, tt.env, tt.name, tt.revision, ret.Name, ret.Revision)
+		}
+	}
+	listTests := []struct {
+		app, env, name string
+		expected       int
+	}{
+		{"a", "", "", 7},
+		{"a", "dev", "", 6},
+		{"", "", "alpha", 2},
+		{"a", "prod", "", 1},
+	}
+	for _, tt := range listTests {
+		ret, err := store.ListServiceRevision(tt.app, tt.env, tt.name)
+		if err != nil {
+			t.Fatalf("ListServiceRevision failed with err: %v", err)
+		}
+		if len(ret) != tt.expected {
+			t.Errorf("ListServiceRevision(%s/%s/%s) returned %d revisions, want %d", tt.app, tt.env, tt.name, len(ret), tt.expected)
+		}
+	}
+}
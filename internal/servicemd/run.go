@@ -0,0 +1,52 @@
+package servicemd
+
+import (
+	"time"
+	"xorm.io/xorm"
+)
+
+// ServiceRun job和cron的执行记录
+type ServiceRun struct {
+	Id         int64  `json:"id" xorm:"pk autoincr"`
+	ServiceId  string `json:"serviceId"`
+	InstanceId string `json:"instanceId"`
+	App        string `json:"app"`
+	Env        string `json:"env"`
+	// StartTime 开始时间 毫秒时间戳
+	StartTime int64 `json:"startTime"`
+	// Duration 执行耗时 单位毫秒
+	Duration   int64     `json:"duration"`
+	Status     string    `json:"status"`
+	StopReason string    `json:"stopReason"`
+	ExitCode   int       `json:"exitCode"`
+	ExitSignal string    `json:"signal"`
+	ErrLog     string    `json:"errLog" xorm:"text"`
+	Created    time.Time `json:"created" xorm:"created"`
+}
+
+func (*ServiceRun) TableName() string {
+	return "zallet_service_run"
+}
+
+func insertServiceRun(session *xorm.Session, run *ServiceRun) error {
+	_, err := session.Insert(run)
+	return err
+}
+
+// deleteServiceRunBefore 删除开始时间早于指定时间的执行记录
+func deleteServiceRunBefore(session *xorm.Session, startTime int64) (int64, error) {
+	return session.
+		Where("start_time < ?", startTime).
+		Delete(new(ServiceRun))
+}
+
+// listServiceRun 按开始时间倒序返回最近的执行记录
+func listServiceRun(session *xorm.Session, serviceId string, limit int) ([]ServiceRun, error) {
+	session.Where("service_id = ?", serviceId)
+	if limit > 0 {
+		session.Limit(limit)
+	}
+	ret := make([]ServiceRun, 0)
+	err := session.Desc("start_time", "id").Find(&ret)
+	return ret, err
+}
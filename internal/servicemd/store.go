@@ -0,0 +1,368 @@
+package servicemd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/spf13/cast"
+	"xorm.io/xorm"
+)
+
+// Store 服务元数据的读写 httpagent只通过Store访问存储
+// mysql实现供多个实例共享 sqlite实现为单机内嵌存储 由xorm.driver选择
+type Store interface {
+	// NowMilli 存储端的当前时间 毫秒时间戳 多个实例以此为统一时钟
+	NowMilli() (int64, error)
+	// Transaction fn中通过tx读写 fn返回错误时回滚
+	Transaction(fn func(tx Store) error) error
+
+	InsertService(service *Service) error
+	UpdateServiceStatus(eventTime, eventSeq int64, serviceId string, serviceStatus string, errLog string, cpuPercent, memPercent int, stopReason string, stopDuration int64, exit *ServiceExit) (bool, error)
+	GetServiceByServiceId(serviceId string) (Service, bool, error)
+	GetServiceByServiceIdAndInstanceId(serviceId, instanceId string) (Service, bool, error)
+	ListService(instanceId, app, status string) ([]Service, error)
+	DeleteServiceByServiceId(serviceId string) (bool, error)
+	ListServiceByKey(instanceId, app, env, name string) ([]Service, error)
+	UpdateServiceSourceByKey(instanceId, app, env, name, source string) (int64, error)
+	ListServiceBySource(instanceId, source string) ([]Service, error)
+	MarkServiceLost(serviceId, stopReason string) (bool, error)
+	ListServiceByInstanceId(instanceId string) ([]Service, error)
+	UpdateServicePid(eventTime int64, serviceId string, pid int, serviceStatus string) (bool, error)
+	IncrServiceRestartCount(serviceId string) (bool, error)
+	UpdateServiceAppYaml(serviceId string, appYaml *process.Yaml) (bool, error)
+
+	ListGlobalServiceByKey(app, env, name string) ([]Service, error)
+	ListGlobalService() ([]Service, error)
+	ListPendingService() ([]Service, error)
+	ListClaimedService() ([]Service, error)
+	ListServiceWithAction(instanceId string) ([]Service, error)
+	ClaimService(eventTime int64, serviceId, instanceId, agentHost, agentToken string) (bool, error)
+	ReleaseService(serviceId, instanceId string) (bool, error)
+	UpdateServiceAction(serviceId, action string) (bool, error)
+	MarkServiceAction(serviceId, action string) (bool, error)
+	UpdateServiceAppYamlAndAction(serviceId string, appYaml *process.Yaml, action string) (bool, error)
+	CountServiceByInstance() (map[string]int, error)
+
+	InsertServiceEvent(event *ServiceEvent) error
+	DeleteServiceEventBefore(eventTime int64) (int64, error)
+	ListServiceEvent(req ListServiceEventReq) ([]ServiceEvent, error)
+
+	InsertServiceRun(run *ServiceRun) error
+	DeleteServiceRunBefore(startTime int64) (int64, error)
+	ListServiceRun(serviceId string, limit int) ([]ServiceRun, error)
+
+	UpsertInstance(instance *Instance) error
+	ListInstance() ([]Instance, error)
+	DeleteInstance(instanceId string) (bool, error)
+
+	InsertServiceRevision(revision *ServiceRevision) error
+	GetServiceRevision(app, env, name string, revision int) (ServiceRevision, bool, error)
+	ListServiceRevision(app, env, name string) ([]ServiceRevision, error)
+}
+
+// NewStore driver为xorm.driver 表结构由migrate创建
+func NewStore(driver string, engine *xorm.Engine) (Store, error) {
+	switch driver {
+	case global.MysqlDriver:
+		return &mysqlStore{xormStore{engine: engine}}, nil
+	case global.SqliteDriver:
+		return &sqliteStore{xormStore{engine: engine}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported xorm driver: %s", driver)
+	}
+}
+
+// mysqlStore 多个实例共享同一个数据库 全局调度和leader选举在实例间生效
+type mysqlStore struct {
+	xormStore
+}
+
+func (s *mysqlStore) NowMilli() (int64, error) {
+	return s.queryNowMilli("SELECT CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED) AS now_milli")
+}
+
+func (s *mysqlStore) Transaction(fn func(tx Store) error) error {
+	return s.transaction(func(tx xormStore) error {
+		return fn(&mysqlStore{tx})
+	})
+}
+
+// sqliteStore BaseDir下的数据库文件 只对本机可见
+type sqliteStore struct {
+	xormStore
+}
+
+func (s *sqliteStore) NowMilli() (int64, error) {
+	return s.queryNowMilli("SELECT CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) AS now_milli")
+}
+
+func (s *sqliteStore) Transaction(fn func(tx Store) error) error {
+	return s.transaction(func(tx xormStore) error {
+		return fn(&sqliteStore{tx})
+	})
+}
+
+// xormStore mysql和sqlite共用的实现 只使用两者都支持的sql
+type xormStore struct {
+	engine *xorm.Engine
+	// tx 不为空时在事务中执行
+	tx *xorm.Session
+}
+
+// session 事务中复用事务的session 否则每次新建 返回关闭函数
+func (s *xormStore) session() (*xorm.Session, func()) {
+	if s.tx != nil {
+		return s.tx, func() {}
+	}
+	session := s.engine.NewSession()
+	return session, func() {
+		session.Close()
+	}
+}
+
+func (s *xormStore) transaction(fn func(tx xormStore) error) error {
+	// 已在事务中时直接执行
+	if s.tx != nil {
+		return fn(*s)
+	}
+	_, err := s.engine.Transaction(func(session *xorm.Session) (any, error) {
+		return nil, fn(xormStore{engine: s.engine, tx: session})
+	})
+	return err
+}
+
+func (s *xormStore) queryNowMilli(sql string) (int64, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	ret, err := session.QueryString(sql)
+	if err != nil {
+		return 0, err
+	}
+	if len(ret) == 0 {
+		return 0, errors.New("query db time failed")
+	}
+	return cast.ToInt64(ret[0]["now_milli"]), nil
+}
+
+func (s *xormStore) InsertService(service *Service) error {
+	session, closeFn := s.session()
+	defer closeFn()
+	return insertService(session, service)
+}
+
+func (s *xormStore) UpdateServiceStatus(eventTime, eventSeq int64, serviceId string, serviceStatus string, errLog string, cpuPercent, memPercent int, stopReason string, stopDuration int64, exit *ServiceExit) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return updateServiceStatus(session, eventTime, eventSeq, serviceId, serviceStatus, errLog, cpuPercent, memPercent, stopReason, stopDuration, exit)
+}
+
+func (s *xormStore) GetServiceByServiceId(serviceId string) (Service, bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return getServiceByServiceId(session, serviceId)
+}
+
+func (s *xormStore) GetServiceByServiceIdAndInstanceId(serviceId, instanceId string) (Service, bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return getServiceByServiceIdAndInstanceId(session, serviceId, instanceId)
+}
+
+func (s *xormStore) ListService(instanceId, app, status string) ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listService(session, instanceId, app, status)
+}
+
+func (s *xormStore) DeleteServiceByServiceId(serviceId string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return deleteServiceByServiceId(session, serviceId)
+}
+
+func (s *xormStore) ListServiceByKey(instanceId, app, env, name string) ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceByKey(session, instanceId, app, env, name)
+}
+
+func (s *xormStore) UpdateServiceSourceByKey(instanceId, app, env, name, source string) (int64, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return updateServiceSourceByKey(session, instanceId, app, env, name, source)
+}
+
+func (s *xormStore) ListServiceBySource(instanceId, source string) ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceBySource(session, instanceId, source)
+}
+
+func (s *xormStore) MarkServiceLost(serviceId, stopReason string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return markServiceLost(session, serviceId, stopReason)
+}
+
+func (s *xormStore) ListServiceByInstanceId(instanceId string) ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceByInstanceId(session, instanceId)
+}
+
+func (s *xormStore) UpdateServicePid(eventTime int64, serviceId string, pid int, serviceStatus string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return updateServicePid(session, eventTime, serviceId, pid, serviceStatus)
+}
+
+func (s *xormStore) IncrServiceRestartCount(serviceId string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return incrServiceRestartCount(session, serviceId)
+}
+
+func (s *xormStore) UpdateServiceAppYaml(serviceId string, appYaml *process.Yaml) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return updateServiceAppYaml(session, serviceId, appYaml)
+}
+
+func (s *xormStore) ListGlobalServiceByKey(app, env, name string) ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listGlobalServiceByKey(session, app, env, name)
+}
+
+func (s *xormStore) ListGlobalService() ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listGlobalService(session)
+}
+
+func (s *xormStore) ListPendingService() ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listPendingService(session)
+}
+
+func (s *xormStore) ListClaimedService() ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listClaimedService(session)
+}
+
+func (s *xormStore) ListServiceWithAction(instanceId string) ([]Service, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceWithAction(session, instanceId)
+}
+
+func (s *xormStore) ClaimService(eventTime int64, serviceId, instanceId, agentHost, agentToken string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return claimService(session, eventTime, serviceId, instanceId, agentHost, agentToken)
+}
+
+func (s *xormStore) ReleaseService(serviceId, instanceId string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return releaseService(session, serviceId, instanceId)
+}
+
+func (s *xormStore) UpdateServiceAction(serviceId, action string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return updateServiceAction(session, serviceId, action)
+}
+
+func (s *xormStore) MarkServiceAction(serviceId, action string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return markServiceAction(session, serviceId, action)
+}
+
+func (s *xormStore) UpdateServiceAppYamlAndAction(serviceId string, appYaml *process.Yaml, action string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return updateServiceAppYamlAndAction(session, serviceId, appYaml, action)
+}
+
+func (s *xormStore) CountServiceByInstance() (map[string]int, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return countServiceByInstance(session)
+}
+
+func (s *xormStore) InsertServiceEvent(event *ServiceEvent) error {
+	session, closeFn := s.session()
+	defer closeFn()
+	return insertServiceEvent(session, event)
+}
+
+func (s *xormStore) DeleteServiceEventBefore(eventTime int64) (int64, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return deleteServiceEventBefore(session, eventTime)
+}
+
+func (s *xormStore) ListServiceEvent(req ListServiceEventReq) ([]ServiceEvent, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceEvent(session, req)
+}
+
+func (s *xormStore) InsertServiceRun(run *ServiceRun) error {
+	session, closeFn := s.session()
+	defer closeFn()
+	return insertServiceRun(session, run)
+}
+
+func (s *xormStore) DeleteServiceRunBefore(startTime int64) (int64, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return deleteServiceRunBefore(session, startTime)
+}
+
+func (s *xormStore) ListServiceRun(serviceId string, limit int) ([]ServiceRun, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceRun(session, serviceId, limit)
+}
+
+func (s *xormStore) UpsertInstance(instance *Instance) error {
+	session, closeFn := s.session()
+	defer closeFn()
+	return upsertInstance(session, instance)
+}
+
+func (s *xormStore) ListInstance() ([]Instance, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listInstance(session)
+}
+
+func (s *xormStore) DeleteInstance(instanceId string) (bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return deleteInstance(session, instanceId)
+}
+
+func (s *xormStore) InsertServiceRevision(revision *ServiceRevision) error {
+	session, closeFn := s.session()
+	defer closeFn()
+	return insertServiceRevision(session, revision)
+}
+
+func (s *xormStore) GetServiceRevision(app, env, name string, revision int) (ServiceRevision, bool, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return getServiceRevision(session, app, env, name, revision)
+}
+
+func (s *xormStore) ListServiceRevision(app, env, name string) ([]ServiceRevision, error) {
+	session, closeFn := s.session()
+	defer closeFn()
+	return listServiceRevision(session, app, env, name)
+}
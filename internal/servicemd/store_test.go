@@ -0,0 +1,103 @@
+package servicemd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/global"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"testing"
+	"time"
+	"xorm.io/xorm"
+)
+
+func newTestStore(t *testing.T) Store {
+	engine, err := xorm.NewEngine(global.SqliteDriver, "file:"+filepath.Join(t.TempDir(), "zallet.db"))
+	if err != nil {
+		t.Fatalf("new engine failed with err: %v", err)
+	}
+	engine.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		engine.Close()
+	})
+	if err = engine.Sync(new(Service), new(ServiceEvent), new(ServiceRevision), new(ServiceRun), new(Instance)); err != nil {
+		t.Fatalf("sync tables failed with err: %v", err)
+	}
+	store, err := NewStore(global.SqliteDriver, engine)
+	if err != nil {
+		t.Fatalf("new store failed with err: %v", err)
+	}
+	return store
+}
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		driver   string
+		expected string
+	}{
+		{global.MysqlDriver, "*servicemd.mysqlStore"},
+		{global.SqliteDriver, "*servicemd.sqliteStore"},
+		{"postgres", ""},
+	}
+	for _, tt := range tests {
+		store, err := NewStore(tt.driver, nil)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("NewStore(%s) should fail", tt.driver)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewStore(%s) failed with err: %v", tt.driver, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", store); got != tt.expected {
+			t.Errorf("NewStore(%s) = %s, want %s", tt.driver, got, tt.expected)
+		}
+	}
+}
+
+func TestSqliteStoreNowMilli(t *testing.T) {
+	store := newTestStore(t)
+	now, err := store.NowMilli()
+	if err != nil {
+		t.Fatalf("NowMilli failed with err: %v", err)
+	}
+	if diff := time.Now().UnixMilli() - now; diff < -1000 || diff > 1000 {
+		t.Errorf("NowMilli() = %d, differs from local time by %dms", now, diff)
+	}
+}
+
+func TestStoreTransaction(t *testing.T) {
+	store := newTestStore(t)
+	rollback := errors.New("rollback")
+	err := store.Transaction(func(tx Store) error {
+		if err := tx.InsertService(&Service{ServiceId: "s1", InstanceId: "i1"}); err != nil {
+			return err
+		}
+		// 事务中可以读到未提交的数据
+		if _, found, err := tx.GetServiceByServiceId("s1"); err != nil || !found {
+			t.Errorf("GetServiceByServiceId in transaction found = %v err = %v", found, err)
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("Transaction() = %v, want %v", err, rollback)
+	}
+	if _, found, err := store.GetServiceByServiceId("s1"); err != nil || found {
+		t.Errorf("GetServiceByServiceId after rollback found = %v err = %v", found, err)
+	}
+	err = store.Transaction(func(tx Store) error {
+		return tx.InsertService(&Service{ServiceId: "s2", InstanceId: "i1"})
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed with err: %v", err)
+	}
+	services, err := store.ListService("i1", "", "")
+	if err != nil {
+		t.Fatalf("ListService failed with err: %v", err)
+	}
+	if len(services) != 1 || services[0].ServiceId != "s2" {
+		t.Errorf("ListService() = %v, want only s2", services)
+	}
+}
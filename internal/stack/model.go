@@ -0,0 +1,136 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LeeZXin/zallet/internal/hashset"
+	"github.com/LeeZXin/zallet/internal/process"
+	"github.com/LeeZXin/zallet/internal/util"
+	"regexp"
+	"sort"
+)
+
+var (
+	ValidNameRegexp = regexp.MustCompile(`^\S+$`)
+)
+
+type ServiceCfg struct {
+	process.Yaml `json:",inline" yaml:",inline"`
+	DependsOn    []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+}
+
+type Cfg struct {
+	Name     string                `json:"name" yaml:"name"`
+	Services map[string]ServiceCfg `json:"services" yaml:"services"`
+}
+
+func (c *Cfg) IsValid() error {
+	if !ValidNameRegexp.MatchString(c.Name) {
+		return errors.New("invalid stack name")
+	}
+	if len(c.Services) == 0 {
+		return errors.New("empty services")
+	}
+	for name, cfg := range c.Services {
+		if !ValidNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid service name: %s", name)
+		}
+		if err := cfg.Yaml.IsValid(); err != nil {
+			return fmt.Errorf("invalid service %s: %v", name, err)
+		}
+		for _, n := range cfg.DependsOn {
+			// 检查dependsOn是否存在
+			if _, b := c.Services[n]; !b {
+				return fmt.Errorf("service does not exist: %v", n)
+			}
+			// 检查dependsOn是否指向自己
+			if n == name {
+				return fmt.Errorf("service depends on itself: %v", n)
+			}
+		}
+	}
+	// 检查依赖是否有环
+	return c.checkRoundService()
+}
+
+type serviceTemp struct {
+	Name      string
+	DependsOn *hashset.HashSet[string]
+}
+
+func (c *Cfg) checkRoundService() error {
+	tmap := make(map[string]*serviceTemp, len(c.Services))
+	for k, cfg := range c.Services {
+		t := &serviceTemp{
+			Name:      k,
+			DependsOn: hashset.NewHashSet[string](),
+		}
+		if len(cfg.DependsOn) > 0 {
+			t.DependsOn.Add(cfg.DependsOn...)
+		}
+		tmap[k] = t
+	}
+	// 每个节点都作为开始节点 首尾相连的环没有不被依赖的节点
+	for _, t := range tmap {
+		if err := c.dfs([]string{}, t, tmap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cfg) dfs(path []string, t *serviceTemp, all map[string]*serviceTemp) error {
+	if util.FindInSlice(path, t.Name) {
+		return fmt.Errorf("round service: %v %v", path, t.Name)
+	}
+	p := append(path[:], t.Name)
+	for _, key := range t.DependsOn.AllKeys() {
+		if err := c.dfs(p, all[key], all); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Order 按依赖关系排序 被依赖的服务在前 同一层级按名称排序
+func (c *Cfg) Order() []string {
+	ret := make([]string, 0, len(c.Services))
+	done := make(map[string]bool, len(c.Services))
+	for len(ret) < len(c.Services) {
+		level := make([]string, 0)
+		for name, cfg := range c.Services {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, n := range cfg.DependsOn {
+				if !done[n] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, name)
+			}
+		}
+		if len(level) == 0 {
+			// 有环 IsValid已检查 不应出现
+			break
+		}
+		sort.Strings(level)
+		for _, name := range level {
+			done[name] = true
+		}
+		ret = append(ret, level...)
+	}
+	return ret
+}
+
+// ServiceYaml 服务的配置 未指定name时使用stack名称加服务名称 避免与其他服务冲突
+func (c *Cfg) ServiceYaml(name string) process.Yaml {
+	y := c.Services[name].Yaml
+	if y.Name == "" {
+		y.Name = c.Name + "." + name
+	}
+	return y
+}
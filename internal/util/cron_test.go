@@ -0,0 +1,89 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronMatch(t *testing.T) {
+	// 2024-01-01为周一 2024-01-07为周日
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		expr  string
+		t     time.Time
+		match bool
+	}{
+		{"* * * * *", at(1, 1, 0, 0), true},
+		{"30 2 * * *", at(1, 1, 2, 30), true},
+		{"30 2 * * *", at(1, 1, 2, 31), false},
+		{"@hourly", at(1, 1, 5, 0), true},
+		{"@hourly", at(1, 1, 5, 1), false},
+		{"@weekly", at(1, 7, 0, 0), true},
+		{"@weekly", at(1, 1, 0, 0), false},
+		// 步长
+		{"*/15 * * * *", at(1, 1, 0, 45), true},
+		{"*/15 * * * *", at(1, 1, 0, 50), false},
+		{"5/10 * * * *", at(1, 1, 0, 25), true},
+		{"5/10 * * * *", at(1, 1, 0, 20), false},
+		{"5/10 * * * *", at(1, 1, 0, 0), false},
+		{"10-20/5 * * * *", at(1, 1, 0, 15), true},
+		{"10-20/5 * * * *", at(1, 1, 0, 25), false},
+		{"0 0-6/3,12 * * *", at(1, 1, 6, 0), true},
+		{"0 0-6/3,12 * * *", at(1, 1, 12, 0), true},
+		{"0 0-6/3,12 * * *", at(1, 1, 4, 0), false},
+		// 周日可用0或7表示
+		{"0 0 * * 0", at(1, 7, 0, 0), true},
+		{"0 0 * * 7", at(1, 7, 0, 0), true},
+		{"0 0 * * 7", at(1, 1, 0, 0), false},
+		{"0 0 * * 5-7", at(1, 7, 0, 0), true},
+		{"0 0 * * 1-5", at(1, 6, 0, 0), false},
+		// 日和周都指定时满足其一即可
+		{"0 0 15 * 1", at(1, 15, 0, 0), true},
+		{"0 0 15 * 1", at(1, 8, 0, 0), true},
+		{"0 0 15 * 1", at(1, 9, 0, 0), false},
+		// 日或周为*时需同时满足
+		{"0 0 15 * *", at(1, 15, 0, 0), true},
+		{"0 0 15 * *", at(1, 8, 0, 0), false},
+		{"0 0 * * 1", at(1, 8, 0, 0), true},
+		{"0 0 * * 1", at(1, 15, 0, 0), true},
+		{"0 0 * * 1", at(1, 9, 0, 0), false},
+		{"0 0 */2 * 1", at(1, 3, 0, 0), false},
+		{"0 0 */2 * 1", at(1, 15, 0, 0), true},
+		{"0 0 1 */3 *", at(4, 1, 0, 0), true},
+		{"0 0 1 */3 *", at(5, 1, 0, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) failed with err: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Match(tt.t); got != tt.match {
+			t.Errorf("ParseCron(%q).Match(%v) = %v, want %v", tt.expr, tt.t, got, tt.match)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every",
+	}
+	for _, expr := range tests {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) should fail", expr)
+		}
+	}
+}
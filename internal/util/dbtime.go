@@ -0,0 +1,25 @@
+package util
+
+import (
+	"errors"
+	"github.com/spf13/cast"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+// DBNowMilli 数据库当前时间 毫秒时间戳
+// 多个实例间比较心跳和租约等时间时以数据库时钟为准 不受本机时钟偏差影响
+func DBNowMilli(session *xorm.Session) (int64, error) {
+	sql := "SELECT CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED) AS now_milli"
+	if session.Engine().Dialect().URI().DBType == schemas.SQLITE {
+		sql = "SELECT CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) AS now_milli"
+	}
+	ret, err := session.QueryString(sql)
+	if err != nil {
+		return 0, err
+	}
+	if len(ret) == 0 {
+		return 0, errors.New("query db time failed")
+	}
+	return cast.ToInt64(ret[0]["now_milli"]), nil
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"strings"
+)
+
+// DiffLines 按行比较 删除的行以"- "开头 新增的行以"+ "开头 相同的行以"  "开头
+func DiffLines(oldText, newText string) []string {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	// 最长公共子序列
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	ret := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, "- "+a[i])
+			i++
+		default:
+			ret = append(ret, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ret = append(ret, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, "+ "+b[j])
+	}
+	return ret
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -1,10 +1,36 @@
 package util
 
 import (
+	"fmt"
+	"strings"
 	"syscall"
 	"time"
 )
 
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ParseSignal 解析信号名 支持SIGTERM和TERM两种写法
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, b := signals[name]
+	if !b {
+		return 0, fmt.Errorf("unsupported signal: %s", name)
+	}
+	return sig, nil
+}
+
+// KillNegativePid 向进程组发送SIGTERM 不等待进程组退出
 func KillNegativePid(pid int) error {
 	errChan := make(chan error)
 	go func() {
@@ -23,3 +49,37 @@ func KillNegativePid(pid int) error {
 		return err
 	}
 }
+
+// TerminateNegativePid 向进程组发送信号并等待整个进程组退出 超时后发送SIGKILL
+func TerminateNegativePid(pid int, sig syscall.Signal, timeout time.Duration) error {
+	err := syscall.Kill(-pid, sig)
+	if err != nil {
+		if err == syscall.ESRCH {
+			return nil
+		}
+		return err
+	}
+	if waitGroupExit(pid, timeout) {
+		return nil
+	}
+	err = syscall.Kill(-pid, syscall.SIGKILL)
+	if err != nil && err != syscall.ESRCH {
+		return err
+	}
+	waitGroupExit(pid, 5*time.Second)
+	return nil
+}
+
+// waitGroupExit 等待进程组退出
+func waitGroupExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if syscall.Kill(-pid, 0) == syscall.ESRCH {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseByteSize 解析 512K 100M 1G 这类大小 不带单位为字节
+func ParseByteSize(size string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(size))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "B"), "I")
+	var unit int64 = 1
+	if len(str) > 0 {
+		switch str[len(str)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	ret, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || ret < 0 {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+	return ret * unit, nil
+}
@@ -3,6 +3,7 @@ package zallet
 import (
 	"github.com/LeeZXin/zallet/internal/global"
 	"github.com/LeeZXin/zallet/internal/httpagent"
+	"github.com/LeeZXin/zallet/internal/migrate"
 	"github.com/LeeZXin/zallet/internal/sshagent"
 	"log"
 	"os"
@@ -12,12 +13,37 @@ import (
 
 func Run() {
 	global.Init()
+	if global.IsEmbeddedStorage() {
+		log.Printf("use embedded sqlite storage, fleet features such as global placement only work on this host")
+	}
+	// 执行数据库迁移
+	if err := migrate.Run(global.Xengine); err != nil {
+		log.Fatalf("migrate failed with err: %v", err)
+	}
+	httpagent.InitStore()
 	httpServer := httpagent.StartServer()
+	// 上报实例心跳
+	heartbeater := httpagent.StartHeartbeat()
+	// 竞选leader 执行全局的定时任务
+	elector := httpagent.StartLeaderElection()
+	// 接管仍在运行的服务
+	httpagent.ReattachServices()
+	// 监听服务配置目录
+	manifestWatcher := httpagent.WatchManifests()
+	// 定时任务调度
+	cronScheduler := httpagent.StartCronScheduler()
+	// 认领全局调度的服务
+	placer := httpagent.StartPlacement()
 	sshServer := sshagent.StartServer()
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("closing")
+	manifestWatcher.Shutdown()
+	cronScheduler.Shutdown()
+	placer.Shutdown()
+	elector.Shutdown()
+	heartbeater.Shutdown()
 	sshServer.Shutdown()
 	httpServer.Shutdown()
 }